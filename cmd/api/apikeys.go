@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// apiKeyUsedInterval is how stale last_used_at can get before a request updates it,
+// a busy integration shouldn't cost a write per request
+const apiKeyUsedInterval = time.Minute
+
+// apiKeyRouteScopes is the scope an API key needs for each route, by mux pattern.
+// routes that aren't listed, like account and key management, only accept tokens
+var apiKeyRouteScopes = map[string]string{
+	"GET /jobs":                                             data.ScopeJobsRead,
+	"GET /jobs/{id}":                                        data.ScopeJobsRead,
+	"POST /jobs":                                            data.ScopeJobsWrite,
+	"POST /jobs/{id}/close":                                 data.ScopeJobsWrite,
+	"GET /applications/{id}/offers":                         data.ScopeApplicationsRead,
+	"GET /applications/{id}/messages":                       data.ScopeApplicationsRead,
+	"GET /offers/{id}":                                      data.ScopeApplicationsRead,
+	"GET /users/me/threads":                                 data.ScopeApplicationsRead,
+	"PUT /applications/{id}/status":                         data.ScopeApplicationsWrite,
+	"POST /applications/{id}/offers":                        data.ScopeApplicationsWrite,
+	"POST /applications/{id}/messages":                      data.ScopeApplicationsWrite,
+	"POST /applications/{id}/messages/read":                 data.ScopeApplicationsWrite,
+	"POST /offers/{id}/send":                                data.ScopeApplicationsWrite,
+	"POST /offers/{id}/withdraw":                            data.ScopeApplicationsWrite,
+	"GET /webhooks":                                         data.ScopeWebhooksRead,
+	"GET /webhooks/{id}/deliveries":                         data.ScopeWebhooksRead,
+	"POST /webhooks":                                        data.ScopeWebhooksWrite,
+	"DELETE /webhooks/{id}":                                 data.ScopeWebhooksWrite,
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver": data.ScopeWebhooksWrite,
+}
+
+// checkAPIKey authenticates a request made with "Authorization: ApiKey <key>"
+func (app *application) checkAPIKey(next http.HandlerFunc, w http.ResponseWriter, r *http.Request, plaintext string) {
+	key, err := app.APIKeys.Authenticate(r.Context(), plaintext)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired API key")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	scope, ok := apiKeyRouteScopes[r.Pattern]
+	if !ok {
+		app.errorResponse(w, r, http.StatusForbidden, "This endpoint cannot be used with an API key")
+		return
+	}
+	if !key.HasScope(scope) {
+		app.errorResponse(w, r, http.StatusForbidden, "API key is missing the "+scope+" scope")
+		return
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyUsedInterval {
+		err = app.APIKeys.MarkUsed(r.Context(), key.Id)
+		if err != nil {
+			// not worth failing the request over
+			logging.FromContext(r.Context()).Error("Cannot record API key use", "api_key_id", key.Id, "error", err)
+		}
+	}
+
+	ctx := setRequestUser(r, key.UserId)
+
+	next(w, r.WithContext(ctx))
+}
+
+// API KEY HANDLERS
+
+// createAPIKeyHandler issues a new API key, the key itself is only shown in this response
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// RBAC check
+	// keys are for recruiters' integrations with their ATS and scripts
+	user, err := app.Users.Get(r.Context(), userId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if user.Role != "recruiter" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only recruiters can create API keys")
+		return
+	}
+
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	key := &data.APIKey{
+		UserId:    userId,
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		ExpiresAt: time.Now().Add(app.Config.Tokens.APIKeyLifetime),
+	}
+	if input.ExpiresAt != nil {
+		key.ExpiresAt = *input.ExpiresAt
+	}
+
+	v := validator.New()
+	data.ValidateAPIKey(v, key)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.APIKeys.Insert(r.Context(), key)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("API key created", "user_id", userId, "api_key_id", key.Id, "scopes", key.Scopes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// listAPIKeysHandler lists the user's keys, without the keys themselves
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	keys, err := app.APIKeys.GetAllForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_keys": keys,
+	})
+}
+
+// deleteAPIKeyHandler revokes one of the user's keys
+func (app *application) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.APIKeys.Delete(r.Context(), id, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "API key not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("API key revoked", "user_id", userId, "api_key_id", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
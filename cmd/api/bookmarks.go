@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// BOOKMARK HANDLERS
+
+// bookmarkJobHandler saves a job for later without applying
+func (app *application) bookmarkJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.Bookmarks.Insert(r.Context(), userId, jobId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Job not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":        jobId,
+		"is_bookmarked": true,
+	})
+}
+
+// unbookmarkJobHandler removes a saved job
+func (app *application) unbookmarkJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.Bookmarks.Delete(r.Context(), userId, jobId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Bookmark not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listBookmarksHandler returns a page of the user's bookmarked jobs
+func (app *application) listBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var filters data.Filters
+	v := validator.New()
+
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	data.ValidateFilters(v, filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	jobs, err := app.Bookmarks.GetJobsForUser(r.Context(), userId, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs": jobs,
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+)
+
+// COMPANY MEMBERSHIP HANDLERS
+
+// addCompanyRecruiterHandler records that a recruiter works for a company, so the
+// company's policies apply to them. Admins confirm this, a job's company proves nothing
+func (app *application) addCompanyRecruiterHandler(w http.ResponseWriter, r *http.Request) {
+	company, recruiter, adminId, ok := app.companyRecruiterRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if recruiter.Role != "recruiter" {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "Only recruiters can be added to a company")
+		return
+	}
+
+	err := app.Companies.AddRecruiter(r.Context(), company, recruiter.Id, adminId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Company recruiter added", "company", company, "user_id", recruiter.Id, "admin_id", adminId)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"company": company,
+		"user_id": recruiter.Id,
+	})
+}
+
+// removeCompanyRecruiterHandler takes a recruiter out of a company
+func (app *application) removeCompanyRecruiterHandler(w http.ResponseWriter, r *http.Request) {
+	company, recruiter, adminId, ok := app.companyRecruiterRequest(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Companies.RemoveRecruiter(r.Context(), company, recruiter.Id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "The user is not a recruiter of this company")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Company recruiter removed", "company", company, "user_id", recruiter.Id, "admin_id", adminId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// companyRecruiterRequest checks the authenticated user is an admin and loads the user
+// from the {id} path value. It writes the error response itself and returns ok=false
+// when the handler should stop.
+func (app *application) companyRecruiterRequest(w http.ResponseWriter, r *http.Request) (string, *data.User, int, bool) {
+	company := r.PathValue("company")
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid user ID")
+		return "", nil, 0, false
+	}
+
+	adminId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return "", nil, 0, false
+	}
+
+	// RBAC check
+	admin, err := app.Users.Get(r.Context(), adminId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return "", nil, 0, false
+	}
+
+	if admin.Role != "admin" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only admins can manage company recruiters")
+		return "", nil, 0, false
+	}
+
+	user, err := app.Users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "User not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return "", nil, 0, false
+	}
+
+	return company, user, admin.Id, true
+}
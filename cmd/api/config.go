@@ -0,0 +1,660 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// config holds every setting the API reads at startup. Each one comes from, in order
+// of precedence: a command line flag, an environment variable (a .env file is loaded
+// into the environment first), the optional config file, or the default below.
+// Social login (OIDC_*) is only read from the environment, its variable names are
+// per provider. Tracing is only read from the environment too, by newTracer in tracing.go:
+// it supports OTEL_TRACES_EXPORTER, OTEL_SERVICE_NAME, OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS. The exporter is
+// internal/tracing, not the OpenTelemetry SDK, so other OTEL_* variables are ignored.
+type config struct {
+	Env            string // development, staging or production
+	Addr           string // where the API listens
+	AdminAddr      string // where /metrics is served, keep it private
+	BaseURL        string // public address used for links in emails
+	LogLevel       slog.Level
+	TrustedProxies []netip.Prefix // proxies whose X-Forwarded-For is believed
+
+	warnings []string // deprecated settings that were used, logged at startup
+
+	Server struct {
+		ReadTimeout       time.Duration
+		ReadHeaderTimeout time.Duration
+		WriteTimeout      time.Duration
+		IdleTimeout       time.Duration
+		ShutdownTimeout   time.Duration // how long in-flight requests get to finish
+		DrainDelay        time.Duration // how long to keep serving after SIGTERM
+		MaxHeaderBytes    int
+		MaxBodyBytes      int
+		HSTSMaxAge        time.Duration // 0 sends no Strict-Transport-Security
+	}
+
+	TLS struct {
+		CertFile string // with KeyFile, serves HTTPS and reloads them when they change
+		KeyFile  string
+	}
+
+	DB struct {
+		DSN          string
+		MaxOpenConns int // 0 is unlimited
+		MaxIdleConns int
+		MaxIdleTime  time.Duration
+		MaxLifetime  time.Duration // 0 keeps connections forever
+	}
+
+	CORS struct {
+		TrustedOrigins   []string // exact or https://*.example.com patterns, empty allows every origin
+		AllowCredentials bool     // lets browsers send cookies and HTTP auth, needs TrustedOrigins
+		AllowedHeaders   []string // request headers a preflight may ask for
+		ExposedHeaders   []string // response headers scripts may read
+		MaxAge           time.Duration
+	}
+
+	Tokens struct {
+		Issuer          string
+		Audience        string
+		KeysDir         string // empty signs with a temporary key
+		SigningKeyID    string
+		SessionLifetime time.Duration // also the lifetime of the login token
+		MFALifetime     time.Duration // two-factor challenge and enrolment tokens
+		APIKeyLifetime  time.Duration // when a new key gives no expiry
+	}
+
+	Mailer struct {
+		Kind         string // log, file or smtp
+		Dir          string
+		Sender       string
+		SMTPHost     string
+		SMTPPort     int
+		SMTPUsername string
+		SMTPPassword string
+		SMTPTimeout  time.Duration
+	}
+
+	RateLimitStore string // memory, postgres or off
+
+	OIDC []oidcProvider // social login providers named in OIDC_PROVIDERS
+}
+
+// oidcProvider is one social login provider, read from OIDC_<NAME>_ISSUER,
+// _CLIENT_ID, _CLIENT_SECRET and optionally _SCOPES
+type oidcProvider struct {
+	Name         string // lowercase, it is also the provider's path under /auth/
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// envPrefix is where the provider's variables start, e.g. OIDC_GOOGLE_
+func (p oidcProvider) envPrefix() string {
+	return "OIDC_" + strings.ToUpper(p.Name) + "_"
+}
+
+// readOIDCProviders reads the providers named in OIDC_PROVIDERS with getenv
+func readOIDCProviders(getenv func(string) string) []oidcProvider {
+	var providers []oidcProvider
+	for _, name := range strings.Split(getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		p := oidcProvider{Name: name}
+		prefix := p.envPrefix()
+		p.Issuer = getenv(prefix + "ISSUER")
+		p.ClientID = getenv(prefix + "CLIENT_ID")
+		p.ClientSecret = getenv(prefix + "CLIENT_SECRET")
+		p.Scopes = strings.Fields(getenv(prefix + "SCOPES"))
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"email", "profile"}
+		}
+
+		providers = append(providers, p)
+	}
+	return providers
+}
+
+func defaultConfig() *config {
+	cfg := &config{
+		Env:       "development",
+		Addr:      ":8080",
+		AdminAddr: "localhost:9090",
+		BaseURL:   "http://localhost:8080",
+		LogLevel:  slog.LevelDebug,
+	}
+
+	cfg.Server.ReadTimeout = 10 * time.Second
+	cfg.Server.ReadHeaderTimeout = 5 * time.Second
+	cfg.Server.WriteTimeout = 30 * time.Second
+	cfg.Server.IdleTimeout = time.Minute
+	cfg.Server.ShutdownTimeout = 5 * time.Second
+	cfg.Server.DrainDelay = 5 * time.Second
+	cfg.Server.MaxHeaderBytes = 64 << 10
+	cfg.Server.MaxBodyBytes = 1 << 20
+	cfg.Server.HSTSMaxAge = 365 * 24 * time.Hour
+
+	cfg.DB.MaxOpenConns = 25
+	cfg.DB.MaxIdleConns = 25
+	cfg.DB.MaxIdleTime = 15 * time.Minute
+	cfg.DB.MaxLifetime = time.Hour
+
+	cfg.CORS.AllowedHeaders = []string{"Accept-Language", "Authorization", "Content-Type", "traceparent", "X-Request-ID"}
+	cfg.CORS.ExposedHeaders = []string{"Content-Language", "RateLimit-Limit", "RateLimit-Policy", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "X-Request-ID"}
+	cfg.CORS.MaxAge = time.Hour
+
+	cfg.Tokens.Audience = "gojobs-api"
+	cfg.Tokens.SessionLifetime = 24 * time.Hour
+	cfg.Tokens.MFALifetime = 5 * time.Minute
+	cfg.Tokens.APIKeyLifetime = 90 * 24 * time.Hour
+
+	cfg.Mailer.Kind = "log"
+	cfg.Mailer.Dir = "tmp/mail"
+	cfg.Mailer.Sender = "GoJobs <no-reply@gojobs.dev>"
+	cfg.Mailer.SMTPPort = 25
+	cfg.Mailer.SMTPTimeout = 30 * time.Second
+
+	cfg.RateLimitStore = "memory"
+
+	return cfg
+}
+
+// setting is one configurable value. Its environment variable name is also its key
+// in the config file
+type setting struct {
+	env    string
+	flag   string
+	usage  string
+	value  flag.Value
+	redact func(string) string // hides secrets in the startup log, nil logs the value
+}
+
+func (cfg *config) settings() []setting {
+	return []setting{
+		{env: "ENV", flag: "env", usage: "environment: development, staging or production", value: stringValue{&cfg.Env}},
+		// PORT is what most platforms set, ADDR wins when both are
+		{env: "PORT", flag: "port", usage: "port to listen on, shorthand for -addr :PORT", value: portValue{&cfg.Addr}},
+		{env: "ADDR", flag: "addr", usage: "address to listen on", value: stringValue{&cfg.Addr}},
+		{env: "ADMIN_ADDR", flag: "admin-addr", usage: "address of the admin listener serving /metrics", value: stringValue{&cfg.AdminAddr}},
+		{env: "BASE_URL", flag: "base-url", usage: "public address used for links in emails", value: stringValue{&cfg.BaseURL}},
+		{env: "LOG_LEVEL", flag: "log-level", usage: "debug, info, warn or error", value: levelValue{&cfg.LogLevel}},
+		{env: "TRUSTED_PROXIES", flag: "trusted-proxies", usage: "comma separated IPs and CIDR ranges allowed to set X-Forwarded-For", value: proxiesValue{&cfg.TrustedProxies}},
+
+		{env: "READ_TIMEOUT", flag: "read-timeout", usage: "maximum time to read a request", value: durationValue{&cfg.Server.ReadTimeout}},
+		{env: "READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "maximum time to read request headers", value: durationValue{&cfg.Server.ReadHeaderTimeout}},
+		{env: "WRITE_TIMEOUT", flag: "write-timeout", usage: "maximum time to write a response", value: durationValue{&cfg.Server.WriteTimeout}},
+		{env: "IDLE_TIMEOUT", flag: "idle-timeout", usage: "how long idle keep-alive connections stay open", value: durationValue{&cfg.Server.IdleTimeout}},
+		{env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "how long in-flight requests get to finish on shutdown", value: durationValue{&cfg.Server.ShutdownTimeout}},
+		{env: "SHUTDOWN_DRAIN_DELAY", flag: "shutdown-drain-delay", usage: "how long to keep serving after SIGTERM while /readyz fails", value: durationValue{&cfg.Server.DrainDelay}},
+		{env: "MAX_HEADER_BYTES", flag: "max-header-bytes", usage: "maximum size of request headers in bytes", value: intValue{&cfg.Server.MaxHeaderBytes}},
+		{env: "MAX_BODY_BYTES", flag: "max-body-bytes", usage: "maximum size of request bodies in bytes", value: intValue{&cfg.Server.MaxBodyBytes}},
+		{env: "HSTS_MAX_AGE", flag: "hsts-max-age", usage: "Strict-Transport-Security max-age for HTTPS requests, 0 turns it off", value: durationValue{&cfg.Server.HSTSMaxAge}},
+		{env: "TLS_CERT_FILE", flag: "tls-cert-file", usage: "PEM certificate chain, serves HTTPS together with the key", value: stringValue{&cfg.TLS.CertFile}},
+		{env: "TLS_KEY_FILE", flag: "tls-key-file", usage: "PEM private key of the certificate", value: stringValue{&cfg.TLS.KeyFile}},
+
+		{env: "DB_DSN", flag: "db-dsn", usage: "PostgreSQL connection string", value: stringValue{&cfg.DB.DSN}, redact: redactDSN},
+		{env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "maximum open database connections, 0 is unlimited", value: intValue{&cfg.DB.MaxOpenConns}},
+		{env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "maximum idle database connections", value: intValue{&cfg.DB.MaxIdleConns}},
+		{env: "DB_MAX_IDLE_TIME", flag: "db-max-idle-time", usage: "how long a database connection may sit idle", value: durationValue{&cfg.DB.MaxIdleTime}},
+		{env: "DB_MAX_LIFETIME", flag: "db-max-lifetime", usage: "how long a database connection is reused, 0 is forever", value: durationValue{&cfg.DB.MaxLifetime}},
+
+		{env: "CORS_TRUSTED_ORIGINS", flag: "cors-trusted-origins", usage: "comma separated origins allowed to call the API from a browser, https://*.example.com matches subdomains, empty allows all", value: listValue{&cfg.CORS.TrustedOrigins}},
+		{env: "CORS_ALLOW_CREDENTIALS", flag: "cors-allow-credentials", usage: "let browsers send cookies with cross-origin requests, needs trusted origins", value: boolValue{&cfg.CORS.AllowCredentials}},
+		{env: "CORS_ALLOWED_HEADERS", flag: "cors-allowed-headers", usage: "comma separated request headers browsers may send", value: listValue{&cfg.CORS.AllowedHeaders}},
+		{env: "CORS_EXPOSED_HEADERS", flag: "cors-exposed-headers", usage: "comma separated response headers scripts may read", value: listValue{&cfg.CORS.ExposedHeaders}},
+		{env: "CORS_MAX_AGE", flag: "cors-max-age", usage: "how long browsers may cache a preflight response", value: durationValue{&cfg.CORS.MaxAge}},
+
+		{env: "JWT_ISSUER", flag: "jwt-issuer", usage: "token issuer, defaults to the base URL", value: stringValue{&cfg.Tokens.Issuer}},
+		{env: "JWT_AUDIENCE", flag: "jwt-audience", usage: "token audience", value: stringValue{&cfg.Tokens.Audience}},
+		{env: "JWT_KEYS_DIR", flag: "jwt-keys-dir", usage: "directory of PEM signing keys, a temporary key is used when empty", value: stringValue{&cfg.Tokens.KeysDir}},
+		{env: "JWT_SIGNING_KEY_ID", flag: "jwt-signing-key-id", usage: "kid of the key that signs, needed with several private keys", value: stringValue{&cfg.Tokens.SigningKeyID}},
+		{env: "SESSION_LIFETIME", flag: "session-lifetime", usage: "how long a login and its token last", value: durationValue{&cfg.Tokens.SessionLifetime}},
+		{env: "MFA_TOKEN_LIFETIME", flag: "mfa-token-lifetime", usage: "how long two-factor challenge and enrolment tokens last", value: durationValue{&cfg.Tokens.MFALifetime}},
+		{env: "API_KEY_LIFETIME", flag: "api-key-lifetime", usage: "how long an API key lasts when created without an expiry", value: durationValue{&cfg.Tokens.APIKeyLifetime}},
+
+		{env: "MAILER", flag: "mailer", usage: "log, file or smtp", value: stringValue{&cfg.Mailer.Kind}},
+		{env: "MAIL_DIR", flag: "mail-dir", usage: "where the file mailer writes emails", value: stringValue{&cfg.Mailer.Dir}},
+		{env: "SMTP_SENDER", flag: "smtp-sender", usage: "From address of emails", value: stringValue{&cfg.Mailer.Sender}},
+		{env: "SMTP_HOST", flag: "smtp-host", usage: "SMTP server", value: stringValue{&cfg.Mailer.SMTPHost}},
+		{env: "SMTP_PORT", flag: "smtp-port", usage: "SMTP port", value: intValue{&cfg.Mailer.SMTPPort}},
+		{env: "SMTP_USERNAME", flag: "smtp-username", usage: "SMTP username, empty for servers without authentication", value: stringValue{&cfg.Mailer.SMTPUsername}},
+		{env: "SMTP_PASSWORD", flag: "smtp-password", usage: "SMTP password", value: stringValue{&cfg.Mailer.SMTPPassword}, redact: redactSecret},
+		{env: "SMTP_TIMEOUT", flag: "smtp-timeout", usage: "how long sending one email may take", value: durationValue{&cfg.Mailer.SMTPTimeout}},
+
+		{env: "RATE_LIMIT_STORE", flag: "rate-limit-store", usage: "memory, postgres (shared between instances) or off", value: stringValue{&cfg.RateLimitStore}},
+	}
+}
+
+// configError lists every problem with the configuration, so they can be fixed in one go
+type configError struct {
+	problems []string
+}
+
+func (e *configError) Error() string {
+	return "invalid configuration: " + strings.Join(e.problems, "; ")
+}
+
+// loadConfig reads the configuration from the command line arguments, the environment
+// and the file named by -config or CONFIG_FILE. The error is flag.ErrHelp for -h,
+// or a *configError listing everything that is wrong
+func loadConfig(args []string) (*config, error) {
+	cfg := defaultConfig()
+	settings := cfg.settings()
+
+	fs := flag.NewFlagSet("api", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "optional file of KEY=value settings, keys are the environment variable names (env CONFIG_FILE)")
+
+	// flags are only recorded here, they're applied last so they win over everything else
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagged []flagValue
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.value.String())
+		fs.Func(s.flag, usage, func(v string) error {
+			flagged = append(flagged, flagValue{s, v})
+			return nil
+		})
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, &configError{problems: []string{fmt.Sprintf("unexpected arguments %q", fs.Args())}}
+	}
+
+	var problems []string
+	apply := func(s setting, value, source string) {
+		err := s.value.Set(value)
+		if err != nil {
+			shown := value
+			if s.redact != nil {
+				shown = s.redact(value)
+			}
+			problems = append(problems, fmt.Sprintf("%s=%q from %s: %v", s.env, shown, source, err))
+		}
+	}
+
+	if *file != "" {
+		values, err := godotenv.Read(*file)
+		if err != nil {
+			return nil, &configError{problems: []string{fmt.Sprintf("cannot read config file: %v", err)}}
+		}
+
+		// applied in the settings' order, so ADDR still wins over PORT
+		for _, s := range settings {
+			value, ok := values[s.env]
+			if ok {
+				apply(s, value, *file)
+				delete(values, s.env)
+			}
+		}
+		for key := range values {
+			problems = append(problems, fmt.Sprintf("%s in %s is not a setting", key, *file))
+		}
+	}
+
+	// the lowercase port variable is what the API first read. It still works, below
+	// every other source, until the deployments that set it have moved to PORT
+	if port := os.Getenv("port"); port != "" && port != os.Getenv("PORT") {
+		i := slices.IndexFunc(settings, func(s setting) bool { return s.env == "PORT" })
+		apply(settings[i], port, "the environment (port)")
+		cfg.warnings = append(cfg.warnings, "the lowercase port variable is deprecated, set PORT instead")
+	}
+
+	// empty variables count as unset, like they always have
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value != "" {
+			apply(s, value, "the environment")
+		}
+	}
+
+	for _, f := range flagged {
+		apply(f.setting, f.value, "-"+f.setting.flag)
+	}
+
+	if cfg.Tokens.Issuer == "" {
+		cfg.Tokens.Issuer = cfg.BaseURL
+	}
+
+	cfg.OIDC = readOIDCProviders(os.Getenv)
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return nil, &configError{problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// validate returns everything wrong with the settings' values together
+func (cfg *config) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(slices.Contains([]string{"development", "staging", "production"}, cfg.Env), "ENV must be development, staging or production")
+	check(validAddr(cfg.Addr), "ADDR must be host:port, e.g. :8080")
+	check(validAddr(cfg.AdminAddr), "ADMIN_ADDR must be host:port, e.g. localhost:9090")
+	check(cfg.Addr != cfg.AdminAddr, "ADDR and ADMIN_ADDR must differ")
+	check(validHTTPURL(cfg.BaseURL), "BASE_URL must be an absolute http or https URL")
+
+	check(cfg.Server.ReadTimeout > 0, "READ_TIMEOUT must be positive")
+	check(cfg.Server.WriteTimeout > 0, "WRITE_TIMEOUT must be positive")
+	check(cfg.Server.IdleTimeout > 0, "IDLE_TIMEOUT must be positive")
+	check(cfg.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(cfg.Server.ReadHeaderTimeout > 0, "READ_HEADER_TIMEOUT must be positive")
+	check(cfg.Server.ReadHeaderTimeout <= cfg.Server.ReadTimeout, "READ_HEADER_TIMEOUT must not be more than READ_TIMEOUT")
+	check(cfg.Server.DrainDelay >= 0, "SHUTDOWN_DRAIN_DELAY must not be negative")
+	check(cfg.Server.MaxHeaderBytes >= 4<<10, "MAX_HEADER_BYTES must be at least 4096")
+	check(cfg.Server.MaxBodyBytes > 0, "MAX_BODY_BYTES must be positive")
+	check(cfg.Server.HSTSMaxAge >= 0, "HSTS_MAX_AGE must not be negative")
+	check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+
+	check(cfg.DB.DSN != "", "DB_DSN must be set")
+	check(cfg.DB.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(cfg.DB.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(cfg.DB.MaxOpenConns == 0 || cfg.DB.MaxIdleConns <= cfg.DB.MaxOpenConns, "DB_MAX_IDLE_CONNS must not be more than DB_MAX_OPEN_CONNS")
+	check(cfg.DB.MaxIdleTime >= 0, "DB_MAX_IDLE_TIME must not be negative")
+	check(cfg.DB.MaxLifetime >= 0, "DB_MAX_LIFETIME must not be negative")
+
+	for _, origin := range cfg.CORS.TrustedOrigins {
+		check(validOrigin(origin), "CORS_TRUSTED_ORIGINS has %q, origins are scheme://host[:port] without a path, or scheme://*.host", origin)
+	}
+	allowAll := len(cfg.CORS.TrustedOrigins) == 0 || slices.Contains(cfg.CORS.TrustedOrigins, "*")
+	check(!cfg.CORS.AllowCredentials || !allowAll, "CORS_ALLOW_CREDENTIALS needs CORS_TRUSTED_ORIGINS without *, any site could act as the user otherwise")
+	check(cfg.CORS.MaxAge >= 0, "CORS_MAX_AGE must not be negative")
+
+	check(cfg.Tokens.Audience != "", "JWT_AUDIENCE must be set")
+	check(cfg.Tokens.KeysDir != "" || cfg.Env != "production", "JWT_KEYS_DIR must be set in production, tokens would stop working on restart")
+	check(cfg.Tokens.SessionLifetime > 0, "SESSION_LIFETIME must be positive")
+	check(cfg.Tokens.MFALifetime > 0, "MFA_TOKEN_LIFETIME must be positive")
+	check(cfg.Tokens.APIKeyLifetime > 0, "API_KEY_LIFETIME must be positive")
+
+	check(slices.Contains([]string{"log", "file", "smtp"}, cfg.Mailer.Kind), "MAILER must be log, file or smtp")
+	check(cfg.Mailer.Kind != "smtp" || cfg.Mailer.SMTPHost != "", "SMTP_HOST must be set when MAILER is smtp")
+	check(cfg.Mailer.SMTPPort > 0 && cfg.Mailer.SMTPPort < 65536, "SMTP_PORT must be between 1 and 65535")
+	check(cfg.Mailer.SMTPTimeout > 0, "SMTP_TIMEOUT must be positive")
+	_, err := mail.ParseAddress(cfg.Mailer.Sender)
+	check(err == nil, "SMTP_SENDER must be an address, e.g. GoJobs <no-reply@gojobs.dev>")
+
+	check(slices.Contains([]string{"memory", "postgres", "off"}, cfg.RateLimitStore), "RATE_LIMIT_STORE must be memory, postgres or off")
+
+	seen := make(map[string]bool)
+	for _, p := range cfg.OIDC {
+		if seen[p.Name] {
+			check(false, "OIDC_PROVIDERS names %q more than once", p.Name)
+			continue
+		}
+		seen[p.Name] = true
+
+		prefix := p.envPrefix()
+		check(validProviderName(p.Name), "OIDC_PROVIDERS has %q, provider names may only have letters, digits and _", p.Name)
+		check(p.Issuer != "", "%sISSUER must be set for the %s provider", prefix, p.Name)
+		check(p.Issuer == "" || validHTTPURL(p.Issuer), "%sISSUER must be an absolute http or https URL", prefix)
+		check(p.ClientID != "", "%sCLIENT_ID must be set for the %s provider", prefix, p.Name)
+	}
+
+	return problems
+}
+
+// logValues returns every setting for the startup log, with secrets redacted
+func (cfg *config) logValues() []interface{} {
+	var attrs []interface{}
+	for _, s := range cfg.settings() {
+		value := s.value.String()
+		if s.redact != nil {
+			value = s.redact(value)
+		}
+		attrs = append(attrs, s.env, value)
+	}
+
+	names := make([]string, len(cfg.OIDC))
+	for i, p := range cfg.OIDC {
+		names[i] = p.Name
+	}
+	attrs = append(attrs, "OIDC_PROVIDERS", strings.Join(names, ","))
+	for _, p := range cfg.OIDC {
+		prefix := p.envPrefix()
+		attrs = append(attrs,
+			prefix+"ISSUER", p.Issuer,
+			prefix+"CLIENT_ID", p.ClientID,
+			prefix+"CLIENT_SECRET", redactSecret(p.ClientSecret),
+			prefix+"SCOPES", strings.Join(p.Scopes, " "),
+		)
+	}
+	return attrs
+}
+
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n < 65536
+}
+
+func validHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validOrigin accepts what browsers send in the Origin header, "*" and
+// patterns with a "*." wildcard at the start of the host
+func validOrigin(s string) bool {
+	if s == "*" {
+		return true
+	}
+	if scheme, host, ok := strings.Cut(s, "://*."); ok {
+		s = scheme + "://" + host
+	}
+	u, err := url.Parse(s)
+	return err == nil && validHTTPURL(s) && u.Path == "" && u.RawQuery == "" && u.User == nil && !strings.Contains(s[len(u.Scheme)+3:], "*")
+}
+
+// validProviderName accepts names that work both in a path and in an environment variable
+func validProviderName(name string) bool {
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// redactSecret hides a secret completely, only whether it is set is logged
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+// redactDSN keeps the host and database of a URL style DSN and hides the password.
+// key=value DSNs are hidden completely
+func redactDSN(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return redactSecret(s)
+	}
+	u.RawQuery = ""
+	return u.Redacted()
+}
+
+// flag.Value implementations writing straight into the config's fields
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(s string) error { *v.p = s; return nil }
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return *v.p
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.New("not true or false")
+	}
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*v.p)
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("not a whole number")
+	}
+	*v.p = n
+	return nil
+}
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+	return strconv.Itoa(*v.p)
+}
+
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("not a duration, e.g. 30s, 15m or 24h")
+	}
+	*v.p = d
+	return nil
+}
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return "0s"
+	}
+	return v.p.String()
+}
+
+type levelValue struct{ p *slog.Level }
+
+func (v levelValue) Set(s string) error {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return errors.New("not a log level, use debug, info, warn or error")
+	}
+	*v.p = level
+	return nil
+}
+
+func (v levelValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.ToLower(v.p.String())
+}
+
+// portValue sets a listen address from a port, ":8080" is accepted too
+type portValue struct{ p *string }
+
+func (v portValue) Set(s string) error {
+	port := strings.TrimPrefix(s, ":")
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return errors.New("not a port number")
+	}
+	*v.p = ":" + port
+	return nil
+}
+
+func (v portValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	_, port, _ := net.SplitHostPort(*v.p)
+	return port
+}
+
+// listValue is a comma separated list, blank items are dropped
+type listValue struct{ p *[]string }
+
+func (v listValue) Set(s string) error {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	*v.p = items
+	return nil
+}
+
+func (v listValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	return strings.Join(*v.p, ",")
+}
+
+type proxiesValue struct{ p *[]netip.Prefix }
+
+func (v proxiesValue) Set(s string) error {
+	prefixes, err := parseTrustedProxies(s)
+	if err != nil {
+		return err
+	}
+	*v.p = prefixes
+	return nil
+}
+
+func (v proxiesValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+	items := make([]string, len(*v.p))
+	for i, prefix := range *v.p {
+		items[i] = prefix.String()
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestLoadConfigLowercasePort(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		args         []string
+		wantAddr     string
+		wantWarnings int
+	}{
+		{"lowercase port still works", map[string]string{"port": "9000"}, nil, ":9000", 1},
+		{"PORT wins", map[string]string{"port": "9000", "PORT": "9001"}, nil, ":9001", 1},
+		{"ADDR wins", map[string]string{"port": "9000", "ADDR": "127.0.0.1:9002"}, nil, "127.0.0.1:9002", 1},
+		{"flag wins", map[string]string{"port": "9000"}, []string{"-addr", ":9003"}, ":9003", 1},
+		{"PORT alone", map[string]string{"PORT": "9004"}, nil, ":9004", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"port", "PORT", "ADDR"} {
+				t.Setenv(key, "")
+			}
+			t.Setenv("DB_DSN", "postgres://localhost/gojobs")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig() error: %v", err)
+			}
+
+			if cfg.Addr != tt.wantAddr {
+				t.Errorf("Addr = %q, want %q", cfg.Addr, tt.wantAddr)
+			}
+			if len(cfg.warnings) != tt.wantWarnings {
+				t.Errorf("warnings = %q, want %d", cfg.warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsMethods are the methods a preflight may ask about, in the order they're listed
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// corsSafelistedHeaders can always be sent, see https://fetch.spec.whatwg.org/#cors-safelisted-request-header
+var corsSafelistedHeaders = []string{"accept", "accept-language", "content-language"}
+
+// corsPolicy decides which browser origins may call the API and answers their preflights.
+// The methods allowed on a path are the ones it has routes for in the mux
+type corsPolicy struct {
+	origins        []string // exact origins or patterns like https://*.example.com, empty allows all
+	credentials    bool
+	allowedHeaders []string // lower case, for matching
+	allowHeaders   string   // as configured, for the response
+	exposedHeaders string
+	maxAge         string // seconds
+	routes         *http.ServeMux
+}
+
+func newCORSPolicy(cfg *config, routes *http.ServeMux) *corsPolicy {
+	p := &corsPolicy{
+		credentials:    cfg.CORS.AllowCredentials,
+		allowHeaders:   strings.Join(cfg.CORS.AllowedHeaders, ", "),
+		exposedHeaders: strings.Join(cfg.CORS.ExposedHeaders, ", "),
+		maxAge:         strconv.Itoa(int(cfg.CORS.MaxAge.Seconds())),
+		routes:         routes,
+	}
+	for _, origin := range cfg.CORS.TrustedOrigins {
+		// "*" is the same as not listing any
+		if origin == "*" {
+			p.origins = nil
+			break
+		}
+		p.origins = append(p.origins, strings.ToLower(origin))
+	}
+	for _, header := range cfg.CORS.AllowedHeaders {
+		p.allowedHeaders = append(p.allowedHeaders, strings.ToLower(header))
+	}
+	return p
+}
+
+// allowAll is true when every origin is allowed, they then get "*"
+func (p *corsPolicy) allowAll() bool {
+	return len(p.origins) == 0
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll() {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.origins {
+		if matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares an origin with an allowed one, where "*." matches
+// one or more subdomain labels, so https://*.example.com doesn't match https://example.com
+func matchOrigin(allowed, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(allowed, "*")
+	if !wildcard {
+		return allowed == origin
+	}
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) || len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	labels := origin[len(prefix) : len(origin)-len(suffix)]
+	return strings.Trim(labels, "abcdefghijklmnopqrstuvwxyz0123456789-.") == ""
+}
+
+// methods returns the methods path has routes for, none when it has no routes at all
+func (p *corsPolicy) methods(path string) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		r := &http.Request{Method: method, URL: &url.URL{Path: path}}
+		_, pattern := p.routes.Handler(r)
+		if pattern == "" {
+			continue
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+// enableCORS adds the CORS headers for allowed origins and answers preflights itself.
+// Preflights from other origins, for paths without routes, or asking for a method
+// or header that isn't allowed are refused, so the browser blocks the real request
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	p := app.CORS
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !p.allowAll() {
+			// the response depends on the origin, caches must keep them apart
+			w.Header().Add("Vary", "Origin")
+		}
+
+		// requests from the same origin and from outside browsers don't need anything
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method == http.MethodOptions && requestMethod != "" {
+			p.preflight(app, w, r, origin, requestMethod)
+			return
+		}
+
+		if p.allowOrigin(origin) {
+			p.setOrigin(w, origin)
+			if p.exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", p.exposedHeaders)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *corsPolicy) preflight(app *application, w http.ResponseWriter, r *http.Request, origin, requestMethod string) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !p.allowOrigin(origin) {
+		app.errorResponse(w, r, http.StatusForbidden, "This origin is not allowed to call the API")
+		return
+	}
+
+	methods := p.methods(r.URL.Path)
+	if len(methods) == 0 {
+		app.errorResponse(w, r, http.StatusNotFound, "The requested resource could not be found")
+		return
+	}
+	if !slices.Contains(methods, requestMethod) {
+		app.errorResponse(w, r, http.StatusForbidden, "This method is not allowed for the requested resource")
+		return
+	}
+
+	for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" || slices.Contains(p.allowedHeaders, header) || slices.Contains(corsSafelistedHeaders, header) {
+			continue
+		}
+		app.errorResponse(w, r, http.StatusForbidden, "These request headers are not allowed")
+		return
+	}
+
+	p.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if p.allowHeaders != "" {
+		w.Header().Set("Access-Control-Allow-Headers", p.allowHeaders)
+	}
+	w.Header().Set("Access-Control-Max-Age", p.maxAge)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin allows the origin: "*" when every origin is allowed, otherwise
+// the origin itself, which is also what browsers need for requests with credentials
+func (p *corsPolicy) setOrigin(w http.ResponseWriter, origin string) {
+	if p.allowAll() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
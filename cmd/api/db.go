@@ -2,18 +2,28 @@ package main
 
 import (
 	"database/sql"
-	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/karnop/gojobs/internal/tracing"
 )
 
 // openDB opens a connection to the database
-// param dsn : Data Source Name (The address string of the DB)
+// cfg.DB has the Data Source Name (The address string of the DB) and the pool sizes
 // it returns a generic *sql.DB pool (The handle to use the DB) that is safe for concurrent use
-func openDB(dsn string) (*sql.DB, error) {
+func openDB(cfg *config) (*sql.DB, error) {
 	// open the connection
-	db, err := sql.Open("pgx", dsn)
+	// the connector wraps pgx so queries run inside a request show up in its trace
+	connector, err := tracing.Connector(stdlib.GetDefaultDriver(), cfg.DB.DSN)
 	if err != nil {
 		return nil, err
 	}
+	db := sql.OpenDB(connector)
+
+	// limiting the pool, so a traffic spike can't use up the server's connections
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetConnMaxIdleTime(cfg.DB.MaxIdleTime)
+	db.SetConnMaxLifetime(cfg.DB.MaxLifetime)
 
 	// testing the connection
 	// sql.open() doesnt connect immediately, it is lazy
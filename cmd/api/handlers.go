@@ -6,11 +6,11 @@ import (
 	"errors"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
 	"github.com/karnop/gojobs/internal/validator"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
-	"time"
 )
 
 // USER HANDLERS
@@ -25,9 +25,9 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// decoding the request
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -50,21 +50,21 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	data.ValidateUser(v, user)
 
 	if !v.Valid() {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnprocessableEntity) // 422
-		json.NewEncoder(w).Encode(v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
 	// insert into Database
-	err = app.Users.Insert(user)
+	err = app.Users.Insert(r.Context(), user)
 	if err != nil {
 		// checking for duplicates
 		if errors.Is(err, data.ErrDuplicateEmail) {
-			v.AddError("email", "a user with this email address already exists")
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict) // 409
-			json.NewEncoder(w).Encode(v.Errors)
+			v.AddErrorCode("email", validator.CodeTaken)
+			app.writeProblem(w, r, problem{
+				Status:     http.StatusConflict, // 409
+				Detail:     "A user with this email address already exists",
+				validation: v,
+			})
 		} else {
 			app.serverError(w, r, err)
 		}
@@ -85,46 +85,112 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// decoding request in a struct
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	// validating user inputs
 	if input.Email == "" || input.Password == "" {
-		http.Error(w, "Email and Password required", http.StatusBadRequest)
+		app.errorResponse(w, r, http.StatusBadRequest, "Email and Password required")
 		return
 	}
 
-	// finding user
-	user, err := app.Users.GetByEmail(input.Email)
+	// refusing attempts while the email or the client IP is blocked after failed logins
+	// this happens whether or not the email belongs to an account
+	wait, err := app.LoginThrottles.BlockedFor(r.Context(), emailLoginKey(input.Email), ipLoginKey(app.clientIP(r)))
 	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		app.serverError(w, r, err)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+		app.errorResponse(w, r, http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+		return
+	}
+
+	// finding user
+	user, err := app.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
 		return
 	}
 
 	// check password
-	match, err := user.Password.Matches(input.Password)
+	// an unknown email still pays for a bcrypt comparison so the timing gives nothing away
+	match := false
+	if user != nil {
+		match, err = user.Password.Matches(input.Password)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		data.SimulatePasswordCheck(input.Password)
+	}
+
+	if !match {
+		err = app.recordLoginFailure(r, input.Email, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.errorResponse(w, r, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	app.finishLogin(w, r, user)
+}
+
+// finishLogin decides what a user who proved who they are, with a password or
+// through an OpenID Connect provider, gets next
+func (app *application) finishLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+	// with two-factor authentication on, the first factor only earns a challenge
+	// the login completes at POST /users/login/mfa
+	if user.MFAEnabled {
+		app.writeMFAChallenge(w, r, user)
+		return
+	}
+
+	// recruiters whose company requires two-factor authentication get a token
+	// that can only be used to set it up
+	required, err := app.MFA.Required(r.Context(), user.Id)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	if !match {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	if required {
+		app.writeMFAEnrolmentToken(w, r, user)
 		return
 	}
 
-	// Generating JWT
-	claims := jwt.MapClaims{
-		"sub":  user.Id,
-		"role": user.Role,
-		"exp":  time.Now().Add(time.Hour * 24).Unix(),
+	app.completeLogin(w, r, user)
+}
+
+// completeLogin records a successful login and sends the user their token
+func (app *application) completeLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+	err := app.recordLoginSuccess(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
+	// the session lets the user see this login and revoke its token
+	session, err := app.startSession(r, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Generating JWT
 	// signing the token with secret key
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	tokenString, err := app.signToken(jwt.MapClaims{
+		"sub":  user.Id,
+		"sid":  session.Id,
+		"role": user.Role,
+		"exp":  session.ExpiresAt.Unix(),
+	})
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -137,34 +203,64 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// jwksHandler publishes the public keys tokens are signed with,
+// so other services can verify our tokens without a shared secret.
+// Every kind of token is signed with them, verifiers tell login tokens apart by
+// their audience, see tokenAudience
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	// verifiers may cache the set, a new key is added well before it starts signing
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": app.Keys.JWKS(),
+	})
+}
+
 // JOB HANDLERS
 
 // createJobHandler handles POST request to add a new job
 func (app *application) createJobHandler(w http.ResponseWriter, r *http.Request) {
 	// variable to hold the incoming data
-	var job data.Job
+	// decoded separately from data.Job so clients can't set its other fields
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Company     string `json:"company"`
+		Salary      int    `json:"salary"`
+	}
 
 	// decoding json body from request
-	err := json.NewDecoder(r.Body).Decode(&job)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
 	// get user id from context
-	userId := r.Context().Value("userId").(int)
-	job.UserId = userId
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	job := data.Job{
+		Title:       input.Title,
+		Description: input.Description,
+		Company:     input.Company,
+		Salary:      input.Salary,
+		UserId:      userId,
+	}
 
 	// RBAC check
 	// only recruiters can post job
-	user, err := app.Users.Get(userId)
+	user, err := app.Users.Get(r.Context(), userId)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
         return
 	}
 
 	if user.Role != "recruiter" {
-		http.Error(w, "Forbidden: Only recruiters can post jobs", http.StatusForbidden) // 403
+		app.errorResponse(w, r, http.StatusForbidden, "Only recruiters can post jobs") // 403
         return
 	}
 
@@ -173,30 +269,20 @@ func (app *application) createJobHandler(w http.ResponseWriter, r *http.Request)
 	data.ValidateJob(v, &job) // v is already passed by reference
 
 	if !v.Valid() {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		json.NewEncoder(w).Encode(v.Errors)
+		app.failedValidationResponse(w, r, v)
 		return
 	}
 
-	// SQL query (postgres)
-	// RETURNING id allows us to get the auto-generated ID back from SQLSERVER.
-	// $1, $2, $3, $4 are placeholders for the data to prevent SQL Injection.
-	query := `
-		INSERT INTO jobs (title, description, company, salary, user_id)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
-	`
-
-	// QueryRow executes a query that returns exactly one row (the ID).
-	err = app.DB.QueryRow(query, job.Title, job.Description, job.Company, job.Salary, job.UserId).Scan(&job.Id)
+	// the job.created webhook event is queued in the same transaction as the insert
+	err = app.Jobs.Insert(r.Context(), &job, app.emitEvent(job.UserId, data.EventJobCreated, &job))
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	app.Metrics.JobsCreated.Inc()
 
 	// structured log
-	app.Logger.Info("Job created successfully", 
+	logging.FromContext(r.Context()).Info("Job created successfully", 
         "job_id", job.Id, 
         "user_id", job.UserId,
         "title", job.Title,
@@ -208,18 +294,20 @@ func (app *application) createJobHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(job)
 }
 
-// listjobshandler handles GET request to show all jobs
-func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title   string
-		Company string
-		data.Filters
-	}
+// jobSearchParams are the query parameters GET /jobs understands besides pagination.
+// saved searches are checked against this list, so new filters must be added here too
+var jobSearchParams = []string{"title", "company", "sort"}
 
-	v := validator.New()
+// jobSearch holds the parsed GET /jobs query parameters
+type jobSearch struct {
+	Title   string
+	Company string
+	data.Filters
+}
 
-	// parse Query Parameters
-	qs := r.URL.Query()
+// readJobSearch parses the GET /jobs query parameters, problems are added to v
+func (app *application) readJobSearch(qs url.Values, v *validator.Validator) jobSearch {
+	var input jobSearch
 
 	input.Title = app.readString(qs, "title", "")
 	input.Company = app.readString(qs, "company", "")
@@ -229,14 +317,39 @@ func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request)
 
 	// validating filters
 	input.Filters.SortSafelist = []string{"id", "title", "company", "salary", "-id", "-title", "-company", "-salary"}
-	
+	data.ValidateFilters(v, input.Filters)
+
+	return input
+}
+
+// listjobshandler handles GET request to show all jobs
+func (app *application) listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	// parse Query Parameters
+	input := app.readJobSearch(r.URL.Query(), v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
 	// calling db
-	jobs, err := app.Jobs.GetAll(input.Title, input.Company, input.Filters)
+	jobs, err := app.Jobs.GetAll(r.Context(), input.Title, input.Company, input.Filters)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	// signed in users see which jobs they bookmarked
+	if userId, ok := r.Context().Value("userId").(int); ok {
+		err = app.Bookmarks.MarkBookmarked(r.Context(), userId, jobs)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	// sending Response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -253,32 +366,28 @@ func (app *application) getJobHandler(w http.ResponseWriter, r *http.Request) {
 	// converting string id to integer
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id < 1 {
-		http.Error(w, "Invalid job Id", http.StatusBadRequest)
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid job ID")
 		return
 	}
 
-	// sql query
-	query := `SELECT id, title, description, company, salary FROM jobs WHERE id = $1`
-	var job data.Job
-
-	err = app.DB.QueryRow(query, id).Scan(
-		&job.Id,
-		&job.Title,
-		&job.Description,
-		&job.Company,
-		&job.Salary,
-	)
-
-	// handle errors
+	job, err := app.Jobs.Get(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Job not found", http.StatusNotFound)
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "Job not found")
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
 
+	if userId, ok := r.Context().Value("userId").(int); ok {
+		err = app.Bookmarks.MarkBookmarked(r.Context(), userId, []*data.Job{job})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(job)
 }
@@ -289,14 +398,30 @@ func (app *application) applyJobHandler(w http.ResponseWriter, r *http.Request)
 	idStr := r.PathValue("id")
 	jobId, err := strconv.Atoi(idStr)
 	if err != nil || jobId < 1 {
-		http.Error(w, "Invalid Job ID", http.StatusBadRequest)
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid job ID")
 		return
 	}
 
 	// getting user id from Context
 	userId, ok := r.Context().Value("userId").(int)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// the job must exist and still be open
+	job, err := app.Jobs.Get(r.Context(), jobId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "Job not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if job.ClosedAt != nil {
+		app.errorResponse(w, r, http.StatusConflict, "Job is closed to new applications")
 		return
 	}
 
@@ -306,19 +431,147 @@ func (app *application) applyJobHandler(w http.ResponseWriter, r *http.Request)
 		UserId : userId,
 	}
 
-	err = app.Applications.Insert(jobApp) 
+	err = app.Applications.Insert(r.Context(), jobApp,
+		app.emitEvent(job.UserId, data.EventApplicationCreated, jobApp),
+		app.enqueueTask(taskApplicationReceivedNotify, jobApp),
+		app.enqueueTask(taskNewApplicantNotify, jobApp),
+	)
 	if err != nil {
 		if errors.Is(err, data.ErrDuplicateApplication) {
-			app.clientError(w, http.StatusConflict) // 409 Conflict
-			// Ideally, send a JSON message: {"error": "You have already applied"}
+			app.errorResponse(w, r, http.StatusConflict, "You have already applied for this job") // 409 Conflict
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
+	app.Metrics.ApplicationsSubmitted.Inc()
 
 	// success
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(jobApp)
 }
+
+// recruiterStatuses are the statuses a recruiter sets directly and the ones each can be
+// reached from. offered, hired and declined only come from offers
+var recruiterStatuses = map[string][]string{
+	data.StatusInterviewing: {data.StatusApplied},
+	data.StatusRejected:     {data.StatusApplied, data.StatusInterviewing},
+}
+
+// updateApplicationStatusHandler lets the job's recruiter move an application to
+// interviewing or reject it, the candidate is notified like for offer changes
+func (app *application) updateApplicationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	applicationId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid application ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	_, ok = recruiterStatuses[input.Status]
+	v.CheckCode(ok, "status", validator.CodeOneOf, data.StatusInterviewing+", "+data.StatusRejected)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	jobApp, job, err := app.applicationWithJob(r.Context(), applicationId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// only the recruiter who posted the job decides on its applications
+	if job.UserId != userId {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the job's recruiter can change an application's status")
+		return
+	}
+
+	err = app.Applications.UpdateStatus(r.Context(), jobApp, input.Status, recruiterStatuses[input.Status],
+		app.emitEvent(job.UserId, data.EventApplicationStatusChanged, jobApp),
+		app.enqueueTask(taskApplicationStatusNotify, jobApp),
+	)
+	if err != nil {
+		if errors.Is(err, data.ErrStatusChange) {
+			app.errorResponse(w, r, http.StatusConflict, "Application can't change to this status from its current one")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Application status changed",
+		"application_id", jobApp.Id,
+		"status", jobApp.Status,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobApp)
+}
+
+// closeJobHandler stops a job taking new applications
+func (app *application) closeJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	job, err := app.Jobs.Get(r.Context(), jobId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.errorResponse(w, r, http.StatusNotFound, "Job not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// only the recruiter who posted the job can close it
+	if job.UserId != userId {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the job's recruiter can close it")
+		return
+	}
+
+	err = app.Jobs.Close(r.Context(), job, app.emitEvent(job.UserId, data.EventJobClosed, job))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusConflict, "Job is already closed")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Job closed", "job_id", job.Id, "user_id", job.UserId)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
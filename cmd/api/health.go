@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/migrations"
+)
+
+const (
+	readyTimeout          = 2 * time.Second // for all the readiness checks together
+	workerHeartbeatMaxAge = 2 * time.Minute // longer than a task may run, see worker.Timeout
+)
+
+// buildInfo describes the running binary, from what the Go toolchain stamped into it
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	CommitAt  string `json:"commit_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"` // built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+}
+
+var build = readBuildInfo()
+
+func readBuildInfo() buildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return buildInfo{Version: "unknown"}
+	}
+
+	b := buildInfo{Version: info.Main.Version, GoVersion: info.GoVersion}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Commit = s.Value
+		case "vcs.time":
+			b.CommitAt = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// check is the result of one readiness check
+type check struct {
+	Status string      `json:"status"` // "ok" or "failing"
+	Error  string      `json:"error,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+type healthResponse struct {
+	Status string           `json:"status"` // "ok", "failing" or "draining"
+	Checks map[string]check `json:"checks,omitempty"`
+	Build  buildInfo        `json:"build"`
+}
+
+// healthzHandler answers as long as the process can serve requests, for liveness probes.
+// It checks nothing else, a database outage shouldn't get every instance restarted
+func (app *application) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeHealth(w, http.StatusOK, healthResponse{Status: "ok", Build: build})
+}
+
+// readyzHandler reports whether this instance should get traffic, for readiness probes
+// and load balancers. It fails while the database, its schema or the worker aren't
+// right, and from the moment shutdown starts so traffic drains away first
+func (app *application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if app.Draining.Load() {
+		app.writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "draining", Build: build})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	res := healthResponse{
+		Status: "ok",
+		Checks: map[string]check{
+			"database":   app.checkDatabase(ctx),
+			"migrations": app.checkMigrations(ctx),
+			"worker":     app.checkWorker(),
+		},
+		Build: build,
+	}
+
+	status := http.StatusOK
+	for _, c := range res.Checks {
+		if c.Status != "ok" {
+			res.Status = "failing"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	app.writeHealth(w, status, res)
+}
+
+func (app *application) checkDatabase(ctx context.Context) check {
+	start := time.Now()
+	err := app.DB.PingContext(ctx)
+	if err != nil {
+		return failing(err)
+	}
+	return check{Status: "ok", Detail: map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()}}
+}
+
+// checkMigrations fails when the schema is behind the migrations built into this binary,
+// or a migration failed halfway. A newer schema is fine, that's a rolling deploy
+func (app *application) checkMigrations(ctx context.Context) check {
+	expected, err := migrations.Latest()
+	if err != nil {
+		return failing(err)
+	}
+
+	version, dirty, err := app.Schema.Version(ctx)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		return failing(errors.New("no migrations have been applied"))
+	}
+	if err != nil {
+		return failing(err)
+	}
+
+	detail := map[string]interface{}{"version": version, "expected": expected}
+	switch {
+	case dirty:
+		return check{Status: "failing", Error: fmt.Sprintf("migration %d failed and left the schema dirty", version), Detail: detail}
+	case version < expected:
+		return check{Status: "failing", Error: "the schema is behind the migrations", Detail: detail}
+	}
+	return check{Status: "ok", Detail: detail}
+}
+
+func (app *application) checkWorker() check {
+	last := app.Worker.LastHeartbeat()
+	if last.IsZero() {
+		return check{Status: "failing", Error: "the worker has not started"}
+	}
+
+	detail := map[string]interface{}{"last_heartbeat": last.UTC().Format(time.RFC3339)}
+	if time.Since(last) > workerHeartbeatMaxAge {
+		return check{Status: "failing", Error: "the worker has stopped polling", Detail: detail}
+	}
+	return check{Status: "ok", Detail: detail}
+}
+
+func failing(err error) check {
+	return check{Status: "failing", Error: err.Error()}
+}
+
+func (app *application) writeHealth(w http.ResponseWriter, status int, res healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"reflect"
     "strconv"
+	"strings"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/karnop/gojobs/internal/i18n"
+	"github.com/karnop/gojobs/internal/logging"
 	"github.com/karnop/gojobs/internal/validator"
 )
 
@@ -30,19 +42,306 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readIDParam reads the {id} wildcard from the request path
+// it returns an error if the id is not a positive integer
+func (app *application) readIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+	return id, nil
+}
+
+// clientIP returns the address of the client that made the request.
+// X-Forwarded-For is only believed when the request came through a trusted proxy,
+// anyone else could put whatever they like in it. The header is read from the right,
+// the first address that isn't one of our proxies is the client.
+func (app *application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+
+	if !app.trustedProxy(addr) {
+		return addr.String()
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+
+		addr = hop.Unmap()
+		if !app.trustedProxy(addr) {
+			break
+		}
+	}
+
+	return addr.String()
+}
+
+// trustedProxy reports whether addr is in one of the TRUSTED_PROXIES ranges
+func (app *application) trustedProxy(addr netip.Addr) bool {
+	for _, prefix := range app.Config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// token scopes, a token with a scope is only accepted where that scope is expected
+const (
+	scopeMFAChallenge = "mfa_challenge" // proves the password, exchanged for a token with a second factor
+	scopeMFAEnrolment = "mfa_enrol"     // only allowed to set up two-factor authentication
+)
+
+// tokenAudience is the aud claim of tokens with scope. Full tokens get JWT_AUDIENCE,
+// limited tokens and the login state cookie get JWT_AUDIENCE:<scope>. The keys are
+// published, so a service verifying our tokens with them and checking the audience
+// can't mistake a token that only proves the password for a login
+func (app *application) tokenAudience(scope string) string {
+	if scope == "" {
+		return app.Config.Tokens.Audience
+	}
+	return app.Config.Tokens.Audience + ":" + scope
+}
+
+// signToken signs claims into a JWT with the current signing key, adding the
+// standard issuer, audience and time claims. The audience follows the scope claim
+func (app *application) signToken(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	scope, _ := claims["scope"].(string)
+
+	claims["iss"] = app.Config.Tokens.Issuer
+	claims["aud"] = app.tokenAudience(scope)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+
+	return app.Keys.Sign(claims)
+}
+
+// parseToken validates a JWT for audience, see tokenAudience, and returns its claims.
+// the kid header picks the verification key, so tokens signed with a
+// rotated out key keep working while it's still in the keyring
+func (app *application) parseToken(tokenString string, audience string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, app.Keys.Keyfunc,
+		jwt.WithValidMethods(app.Keys.Methods()),
+		jwt.WithIssuer(app.Config.Tokens.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(30*time.Second), // clock drift between us and other issuers/verifiers
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// errBodyTooLarge is wrapped in the error for bodies over MAX_BODY_BYTES
+var errBodyTooLarge = errors.New("body must not be larger")
+
+// errBodyTooLargeFor says how large a body may be
+func errBodyTooLargeFor(limit int64) error {
+	return fmt.Errorf("%w than %d bytes", errBodyTooLarge, limit)
+}
+
+// readJSON decodes a request body holding a single JSON object into dst.
+// Unknown fields, trailing data and oversized bodies are rejected, and the
+// error says what was wrong in words that can be shown to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(app.Config.Server.MaxBodyBytes))
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+
+		// Decode returns this instead of a SyntaxError for some truncated bodies
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q, expected %s (at character %d)",
+					unmarshalTypeError.Field, jsonType(unmarshalTypeError.Type), unmarshalTypeError.Offset)
+			}
+			return fmt.Errorf("body contains incorrect JSON type, expected %s (at character %d)",
+				jsonType(unmarshalTypeError.Type), unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		// encoding/json has no error type for this one
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+
+		case errors.As(err, &maxBytesError):
+			return errBodyTooLargeFor(maxBytesError.Limit)
+
+		// a non-pointer dst is a bug in the handler, not the request
+		case errors.As(err, &invalidUnmarshalError):
+			panic(err)
+
+		default:
+			return err
+		}
+	}
+
+	// a second value, or anything but whitespace, after the first is an error
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// jsonType names the JSON type that decodes into t, for error messages
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// ERROR RESPONSES
+
+// problem is an RFC 7807 problem details object, every error the API sends is one
+type problem struct {
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    int                     `json:"status"`
+	Detail    string                  `json:"detail,omitempty"`
+	Instance  string                  `json:"instance,omitempty"`
+	RequestId string                  `json:"request_id,omitempty"`
+	Errors    map[string][]fieldError `json:"errors,omitempty"` // filled in from validation
+
+	validation *validator.Validator
+}
+
+// fieldError is one validation error. Code and params are for clients to act on
+// and stay the same in every language, message is for people to read
+type fieldError struct {
+	Code    string        `json:"code"`
+	Params  []interface{} `json:"params,omitempty"`
+	Message string        `json:"message"`
+}
+
+// writeProblem sends p as application/problem+json. Our problems have no
+// documentation pages, so the type is about:blank and the title is the status text.
+// The title, detail and field errors are translated for the request's Accept-Language
+func (app *application) writeProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	pr := i18n.New(r.Header.Get("Accept-Language"))
+
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Title = pr.Text(p.Title)
+	p.Detail = pr.Text(p.Detail)
+	p.Instance = r.URL.Path
+	p.RequestId, _ = r.Context().Value("requestId").(string)
+
+	if p.validation != nil {
+		p.Errors = make(map[string][]fieldError, len(p.validation.FieldErrors))
+		for key, errs := range p.validation.FieldErrors {
+			for _, e := range errs {
+				p.Errors[key] = append(p.Errors[key], fieldError{
+					Code:    e.Code,
+					Params:  e.Params,
+					Message: pr.Sprintf(e.Format, e.Params...),
+				})
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Content-Language", pr.Tag.String())
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// errorResponse sends an error with the given status, detail is shown to the client as is
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	app.writeProblem(w, r, problem{Status: status, Detail: detail})
+}
+
+// failedValidationResponse sends every field error the validator found with a 422
+func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, v *validator.Validator) {
+	app.writeProblem(w, r, problem{
+		Status:     http.StatusUnprocessableEntity,
+		Detail:     "The request contains invalid fields",
+		validation: v,
+	})
+}
+
+// badRequestResponse sends a 400 explaining err, a 413 when the body was too large
+func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		app.errorResponse(w, r, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
 // serverError logs the detailed error and sends a generic 500 to the user
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	// We include the request method and URL so we know WHERE it happened.
-	app.Logger.Error("server error", 
+	// the request's logger adds the request and user ids
+	logging.FromContext(r.Context()).Error("server error", 
 		"method", r.Method, 
 		"url", r.URL.String(), 
 		"error", err.Error(),
 	)
 
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	app.errorResponse(w, r, http.StatusInternalServerError, "The server encountered a problem and could not process your request")
 }
 
 // clientError sends a specific status code and description to the user.
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
-}
\ No newline at end of file
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status, "")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/karnop/gojobs/internal/keyring"
+)
+
+func TestTokenAudiences(t *testing.T) {
+	keys, err := keyring.Ephemeral()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{Config: defaultConfig(), Keys: keys}
+	app.Config.Tokens.Issuer = app.Config.BaseURL
+
+	scopes := []string{"", scopeMFAChallenge, scopeMFAEnrolment, scopeOIDCState}
+
+	for _, signed := range scopes {
+		token, err := app.signToken(jwt.MapClaims{
+			"sub":   1,
+			"scope": signed,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range scopes {
+			_, err := app.parseToken(token, app.tokenAudience(expected))
+			if signed == expected && err != nil {
+				t.Errorf("token for %q rejected for its own audience: %v", signed, err)
+			}
+			if signed != expected && err == nil {
+				t.Errorf("token for %q accepted for the audience of %q", signed, expected)
+			}
+		}
+	}
+
+	if got := app.tokenAudience(""); got != "gojobs-api" {
+		t.Errorf("full tokens' audience = %q, want JWT_AUDIENCE", got)
+	}
+}
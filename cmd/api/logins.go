@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/worker"
+)
+
+// LOGIN PROTECTION
+
+// loginPolicy decides how long a key is blocked after a number of failed logins.
+// the first few failures are free, then each one adds a doubling delay until the
+// key is locked, and every failure after that doubles the lock
+type loginPolicy struct {
+	window    time.Duration // failures older than this are forgotten
+	free      int
+	lockAfter int
+	lockFor   time.Duration
+	maxLock   time.Duration
+}
+
+var (
+	// per email address, whether or not an account has it
+	accountLoginPolicy = loginPolicy{window: 24 * time.Hour, free: 3, lockAfter: 10, lockFor: 15 * time.Minute, maxLock: 24 * time.Hour}
+	// per client IP, looser since offices and mobile networks share addresses
+	ipLoginPolicy = loginPolicy{window: time.Hour, free: 10, lockAfter: 50, lockFor: 15 * time.Minute, maxLock: 6 * time.Hour}
+)
+
+// maxLoginDelay caps the delay between attempts before a key is locked
+const maxLoginDelay = time.Minute
+
+// block returns how long to block after the given number of failures and whether that is a lockout
+func (p loginPolicy) block(failures int) (time.Duration, bool) {
+	switch {
+	case failures >= p.lockAfter:
+		return min(p.lockFor<<min(failures-p.lockAfter, 16), p.maxLock), true
+	case failures > p.free:
+		return min(time.Second<<min(failures-p.free-1, 16), maxLoginDelay), false
+	}
+	return 0, false
+}
+
+// login throttle keys
+func emailLoginKey(email string) string { return "email:" + strings.ToLower(email) }
+func ipLoginKey(ip string) string       { return "ip:" + ip }
+
+// recordLoginFailure counts a failed login against the email and the client IP and
+// blocks them as the policies say. user is nil when no account has the email.
+func (app *application) recordLoginFailure(r *http.Request, email string, user *data.User) error {
+	app.Metrics.LoginsFailed.Inc()
+	ip := app.clientIP(r)
+
+	failures, err := app.LoginThrottles.RecordFailure(r.Context(), ipLoginKey(ip), ipLoginPolicy.window)
+	if err != nil {
+		return err
+	}
+	if d, _ := ipLoginPolicy.block(failures); d > 0 {
+		err = app.LoginThrottles.Block(r.Context(), ipLoginKey(ip), d)
+		if err != nil {
+			return err
+		}
+	}
+
+	failures, err = app.LoginThrottles.RecordFailure(r.Context(), emailLoginKey(email), accountLoginPolicy.window)
+	if err != nil {
+		return err
+	}
+
+	d, locked := accountLoginPolicy.block(failures)
+	if d == 0 {
+		return nil
+	}
+
+	err = app.LoginThrottles.Block(r.Context(), emailLoginKey(email), d)
+	if err != nil {
+		return err
+	}
+
+	// tell the owner the first time their account gets locked
+	if locked && failures == accountLoginPolicy.lockAfter && user != nil {
+		logging.FromContext(r.Context()).Warn("Account locked", "user_id", user.Id, "ip", ip, "locked_for", d.String())
+
+		return worker.Enqueue(r.Context(), app.DB, taskAccountLockedNotify, loginNotice{
+			UserId: user.Id,
+			IP:     ip,
+			Until:  time.Now().Add(d).UTC(),
+		})
+	}
+
+	return nil
+}
+
+// recordLoginSuccess clears the failures on the email and emails the user
+// when the login came from a device they haven't used before
+func (app *application) recordLoginSuccess(r *http.Request, user *data.User) error {
+	err := app.LoginThrottles.Reset(r.Context(), emailLoginKey(user.Email))
+	if err != nil {
+		return err
+	}
+
+	ip := app.clientIP(r)
+
+	isNew, err := app.LoginDevices.Seen(r.Context(), user.Id, ip, r.UserAgent())
+	if err != nil {
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+
+	return worker.Enqueue(r.Context(), app.DB, taskNewLoginNotify, loginNotice{
+		UserId:    user.Id,
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		At:        time.Now().UTC(),
+	})
+}
+
+// ADMIN HANDLERS
+
+// unlockUserHandler lifts a lockout on a user's account before it runs out
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	adminId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// RBAC check
+	admin, err := app.Users.Get(r.Context(), adminId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if admin.Role != "admin" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only admins can unlock accounts")
+		return
+	}
+
+	user, err := app.Users.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "User not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.LoginThrottles.Reset(r.Context(), emailLoginKey(user.Email))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Account unlocked", "user_id", user.Id, "admin_id", admin.Id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account unlocked",
+	})
+}
+
+// LOGIN NOTIFICATION TASKS
+
+// loginNotice is the payload of the security email tasks
+type loginNotice struct {
+	UserId    int       `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	At        time.Time `json:"at,omitzero"`
+	Until     time.Time `json:"until,omitzero"`
+}
+
+// notifyAccountLockedTask tells a user their account was locked after failed logins.
+// security emails ignore the notification preferences
+func (app *application) notifyAccountLockedTask(ctx context.Context, task *worker.Task) error {
+	var notice loginNotice
+	err := task.Decode(&notice)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.Users.Get(ctx, notice.UserId)
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(ctx, user.Email, "account_locked.tmpl", map[string]interface{}{
+		"Name":  user.Name,
+		"IP":    notice.IP,
+		"Until": notice.Until.Format(time.RFC1123),
+	})
+}
+
+// notifyNewLoginTask tells a user someone logged in to their account from a new device
+func (app *application) notifyNewLoginTask(ctx context.Context, task *worker.Task) error {
+	var notice loginNotice
+	err := task.Decode(&notice)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.Users.Get(ctx, notice.UserId)
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(ctx, user.Email, "new_login.tmpl", map[string]interface{}{
+		"Name":      user.Name,
+		"IP":        notice.IP,
+		"UserAgent": notice.UserAgent,
+		"At":        notice.At.Format(time.RFC1123),
+	})
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/karnop/gojobs/internal/data"
@@ -11,8 +13,19 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"net/netip"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/karnop/gojobs/internal/keyring"
+	"github.com/karnop/gojobs/internal/mailer"
+	"github.com/karnop/gojobs/internal/oidc"
+	"github.com/karnop/gojobs/internal/ratelimit"
+	"github.com/karnop/gojobs/internal/tlscert"
+	"github.com/karnop/gojobs/internal/tracing"
+	"github.com/karnop/gojobs/internal/worker"
 )
 
 // defining a struct to hold application dependencies
@@ -22,15 +35,43 @@ type application struct {
 	Users  data.UserModel
 	Applications data.JobApplicationModel
 	Jobs data.JobModel
+	Offers data.OfferModel
+	Messages data.MessageModel
+	SavedSearches data.SavedSearchModel
+	Bookmarks data.BookmarkModel
+	Webhooks data.WebhookModel
+	NotificationPreferences data.NotificationPreferenceModel
+	LoginThrottles data.LoginThrottleModel
+	LoginDevices data.LoginDeviceModel
+	MFA data.MFAModel
+	Companies data.CompanyModel
+	Identities data.IdentityModel
+	APIKeys data.APIKeyModel
+	Sessions data.SessionModel
+	Schema data.SchemaModel
+	SessionTracker *sessionTracker // batches session last seen updates
+	Mailer mailer.Mailer
+	RateLimiter ratelimit.Store // nil turns rate limiting off
+	Config *config // settings from flags, environment and the config file
+	CORS *corsPolicy // which browser origins may call the API
+	Keys *keyring.Keyring // signs and verifies tokens
+	OIDCProviders map[string]*oidc.Provider // social login providers by name
+	Metrics *appMetrics
+	Worker *worker.Worker // its heartbeat is part of readiness
+	Draining atomic.Bool // set once shutdown starts, readiness fails from then on
 	Logger *slog.Logger
+
 }
 
 // entry point of the application
 func main() {
-	// initializing structured logger
+	// initializing structured logger, the level is set once the config is read
+	logLevel := new(slog.LevelVar)
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level: logLevel,
 	}))
+	// logging.FromContext falls back to the default logger outside requests
+	slog.SetDefault(logger)
 
 	// loading the env file
 	err := godotenv.Load()
@@ -38,21 +79,53 @@ func main() {
 		logger.Info("No .env file found, relying on system environment variables")
 	}
 
-	port := os.Getenv("port")
-	if port == "" {
-		logger.Error("DB_DSN environment variable not set")
+	// reading flags, environment and the config file, every problem is reported before exiting
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	var cfgErr *configError
+	if errors.As(err, &cfgErr) {
+		logger.Error("Invalid configuration", "problems", cfgErr.problems)
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.Error("Invalid configuration", "error", err)
+		os.Exit(2)
+	}
+	logLevel.Set(cfg.LogLevel)
+	logger.Info("Configuration loaded", slog.Group("config", cfg.logValues()...))
+	for _, warning := range cfg.warnings {
+		logger.Warn("Deprecated configuration", "warning", warning)
+	}
+
+	keys, err := loadKeyring(cfg, logger)
+	if err != nil {
+		logger.Error("Cannot load JWT keys", "error", err)
+		os.Exit(1)
 	}
 
-	dsn := os.Getenv("DB_DSN")
-	if dsn == "" {
-		logger.Error("DB_DSN environment variable not set")
+	// with a certificate the API serves HTTPS itself, renewed files are picked up while it runs
+	var certs *tlscert.Reloader
+	if cfg.TLS.CertFile != "" {
+		certs, err = tlscert.New(cfg.TLS.CertFile, cfg.TLS.KeyFile, logger)
+		if err != nil {
+			logger.Error("Cannot load TLS certificate", "error", err)
+			os.Exit(1)
+		}
 	}
+
+	// traces are only recorded when an exporter is configured
+	tracer := newTracer(logger)
+	tracing.SetDefault(tracer)
+
 	logger.Info("Connecting to Cloud Database...")
 
 	// calling helper function to open the connection
-	db, err := openDB(dsn)
+	db, err := openDB(cfg)
 	if err != nil {
 		logger.Error("Cannot connect to database", "error", err)
+		os.Exit(1)
 	}
 	defer db.Close()
 	logger.Info("SUCCESS! Database connection established")
@@ -62,35 +135,140 @@ func main() {
 		Users:  data.UserModel{DB: db},
 		Applications: data.JobApplicationModel{DB: db},
 		Jobs : data.JobModel{DB: db},
+		Offers: data.OfferModel{DB: db},
+		Messages: data.MessageModel{DB: db},
+		SavedSearches: data.SavedSearchModel{DB: db},
+		Bookmarks: data.BookmarkModel{DB: db},
+		Webhooks: data.WebhookModel{DB: db},
+		NotificationPreferences: data.NotificationPreferenceModel{DB: db},
+		LoginThrottles: data.LoginThrottleModel{DB: db},
+		LoginDevices: data.LoginDeviceModel{DB: db},
+		MFA: data.MFAModel{DB: db},
+		Companies: data.CompanyModel{DB: db},
+		Identities: data.IdentityModel{DB: db},
+		APIKeys: data.APIKeyModel{DB: db},
+		Sessions: data.SessionModel{DB: db},
+		Schema: data.SchemaModel{DB: db},
+		SessionTracker: newSessionTracker(data.SessionModel{DB: db}, logger),
+		OIDCProviders: loadOIDCProviders(cfg),
+		Mailer: newMailer(cfg, logger),
+		RateLimiter: newRateLimiter(cfg, db),
+		Config: cfg,
+		Keys: keys,
+		Metrics: newMetrics(db),
 		Logger: logger,
 	}
 
+	// the worker runs queued tasks and periodic jobs in-process
+	// its context is cancelled on shutdown, Run returns once in-flight tasks finish
+	bgWorker := worker.New(db, logger)
+	app.registerTasks(bgWorker)
+	app.Worker = bgWorker
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+
+	workerDone := make(chan struct{})
+	go func() {
+		bgWorker.Run(workerCtx)
+		close(workerDone)
+	}()
+
+	// session last seen times are flushed in batches, and once more on shutdown
+	trackerDone := make(chan struct{})
+	go func() {
+		app.SessionTracker.Run(workerCtx)
+		close(trackerDone)
+	}()
+
 	// NewServeMux is a request multiplier (router).
 	// It matches the URL of incoming request against a list of registered patterns
 	// and calls the corresponding handler.
 	mux := http.NewServeMux()
 
 	// Register a simple health check route
-	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+	// {$} matches / only, requests matching no route are answered by unmatchedRoutes
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Welcome to the GoJobs API")
 	})
 
-	mux.HandleFunc("GET /jobs", app.listJobsHandler)
+	// probes for the orchestrator and load balancer, see health.go
+	mux.HandleFunc("GET /healthz", app.healthzHandler)
+	mux.HandleFunc("GET /readyz", app.readyzHandler)
+
+	mux.HandleFunc("GET /.well-known/jwks.json", app.jwksHandler)
+	mux.HandleFunc("GET /jobs", app.authenticateOptional(app.listJobsHandler))
 	mux.HandleFunc("POST /jobs", app.authenticate(app.createJobHandler))
-	mux.HandleFunc("GET /jobs/{id}", app.getJobHandler)
-	mux.HandleFunc("POST /users", app.registerUserHandler)
-	mux.HandleFunc("POST /users/login", app.loginUserHandler)
-	mux.HandleFunc("POST /jobs/{id}/apply", app.authenticate(app.applyJobHandler))
+	mux.HandleFunc("GET /jobs/{id}", app.authenticateOptional(app.getJobHandler))
+	mux.HandleFunc("POST /users", app.rateLimit("register", registerRateLimit, app.registerUserHandler))
+	mux.HandleFunc("POST /users/login", app.rateLimit("login", loginRateLimit, app.loginUserHandler))
+	mux.HandleFunc("POST /jobs/{id}/apply", app.authenticate(app.rateLimit("apply", applyRateLimit, app.applyJobHandler)))
+	mux.HandleFunc("PUT /applications/{id}/status", app.authenticate(app.updateApplicationStatusHandler))
+	mux.HandleFunc("POST /applications/{id}/offers", app.authenticate(app.createOfferHandler))
+	mux.HandleFunc("GET /applications/{id}/offers", app.authenticate(app.listOffersHandler))
+	mux.HandleFunc("GET /offers/{id}", app.authenticate(app.getOfferHandler))
+	mux.HandleFunc("POST /offers/{id}/send", app.authenticate(app.sendOfferHandler))
+	mux.HandleFunc("POST /offers/{id}/withdraw", app.authenticate(app.withdrawOfferHandler))
+	mux.HandleFunc("POST /offers/{id}/accept", app.authenticate(app.acceptOfferHandler))
+	mux.HandleFunc("POST /offers/{id}/decline", app.authenticate(app.declineOfferHandler))
+	mux.HandleFunc("GET /applications/{id}/messages", app.authenticate(app.listMessagesHandler))
+	mux.HandleFunc("POST /applications/{id}/messages", app.authenticate(app.sendMessageHandler))
+	mux.HandleFunc("POST /applications/{id}/messages/read", app.authenticate(app.markMessagesReadHandler))
+	mux.HandleFunc("GET /users/me/threads", app.authenticate(app.listThreadsHandler))
+	mux.HandleFunc("POST /users/me/saved-searches", app.authenticate(app.createSavedSearchHandler))
+	mux.HandleFunc("GET /users/me/saved-searches", app.authenticate(app.listSavedSearchesHandler))
+	mux.HandleFunc("DELETE /users/me/saved-searches/{id}", app.authenticate(app.deleteSavedSearchHandler))
+	mux.HandleFunc("POST /jobs/{id}/close", app.authenticate(app.closeJobHandler))
+	mux.HandleFunc("POST /webhooks", app.authenticate(app.createWebhookHandler))
+	mux.HandleFunc("GET /webhooks", app.authenticate(app.listWebhooksHandler))
+	mux.HandleFunc("DELETE /webhooks/{id}", app.authenticate(app.deleteWebhookHandler))
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", app.authenticate(app.listWebhookDeliveriesHandler))
+	mux.HandleFunc("POST /webhooks/{id}/deliveries/{deliveryId}/redeliver", app.authenticate(app.redeliverWebhookHandler))
+	mux.HandleFunc("POST /jobs/{id}/bookmark", app.authenticate(app.bookmarkJobHandler))
+	mux.HandleFunc("DELETE /jobs/{id}/bookmark", app.authenticate(app.unbookmarkJobHandler))
+	mux.HandleFunc("GET /users/me/bookmarks", app.authenticate(app.listBookmarksHandler))
+	mux.HandleFunc("GET /users/me/notifications", app.authenticate(app.getNotificationPreferencesHandler))
+	mux.HandleFunc("PUT /users/me/notifications", app.authenticate(app.updateNotificationPreferencesHandler))
+	mux.HandleFunc("GET /auth/{provider}/login", app.rateLimit("oidc", loginRateLimit, app.oidcLoginHandler))
+	mux.HandleFunc("GET /auth/{provider}/callback", app.oidcCallbackHandler)
+	mux.HandleFunc("POST /users/login/mfa", app.rateLimit("login_mfa", loginRateLimit, app.loginMFAHandler))
+	mux.HandleFunc("POST /users/me/mfa/totp", app.authenticateEnrolment(app.enrolTOTPHandler))
+	mux.HandleFunc("POST /users/me/mfa/totp/confirm", app.authenticateEnrolment(app.confirmTOTPHandler))
+	mux.HandleFunc("DELETE /users/me/mfa/totp", app.authenticate(app.disableTOTPHandler))
+	mux.HandleFunc("POST /users/me/mfa/recovery-codes", app.authenticate(app.regenerateRecoveryCodesHandler))
+	mux.HandleFunc("POST /admin/users/{id}/unlock", app.authenticate(app.unlockUserHandler))
+	mux.HandleFunc("PUT /admin/companies/{company}/mfa", app.authenticate(app.setCompanyMFAPolicyHandler))
+	mux.HandleFunc("PUT /admin/companies/{company}/recruiters/{id}", app.authenticate(app.addCompanyRecruiterHandler))
+	mux.HandleFunc("DELETE /admin/companies/{company}/recruiters/{id}", app.authenticate(app.removeCompanyRecruiterHandler))
+	mux.HandleFunc("POST /users/me/api-keys", app.authenticate(app.createAPIKeyHandler))
+	mux.HandleFunc("GET /users/me/api-keys", app.authenticate(app.listAPIKeysHandler))
+	mux.HandleFunc("DELETE /users/me/api-keys/{id}", app.authenticate(app.deleteAPIKeyHandler))
+	mux.HandleFunc("GET /users/me/sessions", app.authenticate(app.listSessionsHandler))
+	mux.HandleFunc("DELETE /users/me/sessions", app.authenticate(app.deleteAllSessionsHandler))
+	mux.HandleFunc("DELETE /users/me/sessions/{id}", app.authenticate(app.deleteSessionHandler))
+	mux.HandleFunc("GET /saved-searches/unsubscribe", app.unsubscribeConfirmHandler)
+	mux.HandleFunc("POST /saved-searches/unsubscribe", app.unsubscribeHandler)
 
-	logger.Info("Starting server", "addr", port, "env", "development")
+	// the CORS policy looks up each preflight's path in the routes, so it's made once they're all registered
+	app.CORS = newCORSPolicy(cfg, mux)
 
 	// defining the server struct
+	// the header limits stop clients holding connections open or sending huge headers
 	srv := &http.Server{
-		Addr:  ":8080",
-		Handler: app.enableCORS(mux), 
-		IdleTimeout: time.Minute,
-		ReadTimeout: 10*time.Second,
-		WriteTimeout: 30*time.Second,
+		Addr:  cfg.Addr,
+		Handler: app.requestID(app.traceRequests(app.logRequests(app.recordMetrics(app.recoverPanic(app.secureHeaders(app.limitBody(app.enableCORS(app.rateLimitAll(app.unmatchedRoutes(mux)))))))))),
+		IdleTimeout: cfg.Server.IdleTimeout,
+		ReadTimeout: cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
+	}
+	if certs != nil {
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+		go certs.Run(workerCtx, tlsReloadInterval)
 	}
 
 	// creating a specific channel to listen for shutdown signals
@@ -99,8 +277,14 @@ func main() {
 
 	// starting the server in a background routine
 	go func() {
-		logger.Info("Starting server", "addr", srv.Addr, "env", "development")
-		err := srv.ListenAndServe()
+		logger.Info("Starting server", "addr", srv.Addr, "env", cfg.Env, "tls", certs != nil)
+		var err error
+		if certs != nil {
+			// the certificate comes from TLSConfig, not from file names here
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
 
 		// ListenAndServe always returns a non nil error
 		// If its just - ServerClosed (which happens when we shutdown), that's normal
@@ -109,6 +293,25 @@ func main() {
 		}
 	}()
 
+	// the admin listener serves /metrics, it should only be reachable from inside
+	// the deployment, so it binds to localhost unless ADMIN_ADDR says otherwise
+	adminSrv := &http.Server{
+		Addr:              cfg.AdminAddr,
+		Handler:           app.adminRoutes(),
+		ReadTimeout:       5 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	go func() {
+		logger.Info("Starting admin server", "addr", adminSrv.Addr)
+		err := adminSrv.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			shutdownError <- err
+		}
+	}()
+
 	// listening for os signals
 	// we want to catch interrupt(ctrl + c) and SIGTERM(docker/kubernetes stop)
 	quit := make(chan os.Signal, 1)
@@ -123,11 +326,19 @@ func main() {
 
 	case sig:= <-quit:
 		logger.Info("Shutting down server", "signal", sig.String())
+
+		// SIGTERM comes from the orchestrator, which takes the instance out of the load balancer
+		// once /readyz fails. Serving on for a while lets that happen before connections are refused
+		app.Draining.Store(true)
+		if sig == syscall.SIGTERM {
+			logger.Info("Draining before shutdown", "delay", cfg.Server.DrainDelay.String())
+			time.Sleep(cfg.Server.DrainDelay)
+		}
 	}
 
 	// graceful shutdown
-	// we give active requests 5 seconds to finish
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// we give active requests SHUTDOWN_TIMEOUT (5 seconds by default) to finish
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	// shutdown stops accepting new requests and waits for active ones
@@ -137,5 +348,125 @@ func main() {
         err = srv.Close() // force close
 	}
 
+	// the admin server goes last so metrics can be scraped while requests drain
+	err = adminSrv.Shutdown(ctx)
+	if err != nil {
+		logger.Error("Admin server shutdown failed", "error", err)
+		adminSrv.Close()
+	}
+
+	// draining the worker, tasks that are already running get to finish
+	stopWorker()
+	<-workerDone
+	<-trackerDone
+
+	// exporting the spans of the last requests
+	if tracer != nil {
+		err = tracer.Shutdown(ctx)
+		if err != nil {
+			logger.Error("Trace export on shutdown failed", "error", err)
+		}
+	}
+
 	logger.Info("Server stopped")  
 }
+
+// tlsReloadInterval is how often the certificate files are checked for changes
+const tlsReloadInterval = time.Minute
+
+// newMailer picks how emails are delivered from MAILER: "smtp" sends them through
+// SMTP_HOST, "file" writes .eml files into MAIL_DIR, "log" logs them
+func newMailer(cfg *config, logger *slog.Logger) mailer.Mailer {
+	switch cfg.Mailer.Kind {
+	case "smtp":
+		return mailer.SMTPMailer{
+			Host:     cfg.Mailer.SMTPHost,
+			Port:     cfg.Mailer.SMTPPort,
+			Username: cfg.Mailer.SMTPUsername,
+			Password: cfg.Mailer.SMTPPassword,
+			Sender:   cfg.Mailer.Sender,
+			Timeout:  cfg.Mailer.SMTPTimeout,
+		}
+
+	case "file":
+		return mailer.FileMailer{Dir: cfg.Mailer.Dir, Sender: cfg.Mailer.Sender}
+
+	default:
+		return mailer.LogMailer{Logger: logger}
+	}
+}
+
+// newRateLimiter picks where rate limit buckets live from RATE_LIMIT_STORE:
+// "postgres" shares them between API instances, "off" disables rate limiting,
+// "memory" keeps them in this process
+func newRateLimiter(cfg *config, db *sql.DB) ratelimit.Store {
+	switch cfg.RateLimitStore {
+	case "postgres":
+		return ratelimit.PostgresStore{DB: db}
+	case "off":
+		return nil
+	default:
+		return ratelimit.NewMemoryStore()
+	}
+}
+
+// parseTrustedProxies parses a comma separated list of IPs and CIDR ranges
+func parseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return prefixes, nil
+}
+
+// loadKeyring loads the token signing keys from JWT_KEYS_DIR, JWT_SIGNING_KEY_ID
+// picks the signing key when the directory holds more than one private key.
+// without a directory a throwaway key is generated, tokens then stop working on restart
+func loadKeyring(cfg *config, logger *slog.Logger) (*keyring.Keyring, error) {
+	if cfg.Tokens.KeysDir == "" {
+		logger.Warn("JWT_KEYS_DIR not set, signing tokens with a temporary key")
+		return keyring.Ephemeral()
+	}
+
+	return keyring.Load(cfg.Tokens.KeysDir, cfg.Tokens.SigningKeyID)
+}
+
+// loadOIDCProviders sets up the social login providers from the configuration,
+// each provider must redirect back to BASE_URL/auth/<name>/callback
+func loadOIDCProviders(cfg *config) map[string]*oidc.Provider {
+	providers := make(map[string]*oidc.Provider)
+
+	for _, p := range cfg.OIDC {
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  strings.TrimSuffix(cfg.BaseURL, "/") + "/auth/" + p.Name + "/callback",
+			Scopes:       p.Scopes,
+		})
+	}
+
+	return providers
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// MESSAGE HANDLERS
+
+// listMessagesHandler returns a page of an application's thread. Reading it doesn't
+// mark anything read, clients do that with POST .../messages/read once the messages are shown
+func (app *application) listMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	jobApp, _, _, ok := app.threadForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+	v := validator.New()
+
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 50, v)
+
+	data.ValidateFilters(v, filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	messages, err := app.Messages.GetAllForApplication(r.Context(), jobApp.Id, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages": messages,
+	})
+}
+
+// markMessagesReadHandler sets the read receipts on the messages the other participant
+// sent, up to the id in up_to, usually the newest message the reader was shown
+func (app *application) markMessagesReadHandler(w http.ResponseWriter, r *http.Request) {
+	jobApp, _, userId, ok := app.threadForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UpTo int `json:"up_to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.CheckCode(input.UpTo > 0, "up_to", validator.CodeGreaterThan, 0)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.Messages.MarkRead(r.Context(), jobApp.Id, userId, input.UpTo)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendMessageHandler posts a message to an application's thread and emails the other participant
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	jobApp, _, userId, ok := app.threadForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	message := &data.Message{
+		ApplicationId: jobApp.Id,
+		SenderId:      userId,
+		Body:          input.Body,
+	}
+
+	v := validator.New()
+	data.ValidateMessage(v, message)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	// the email notification is queued in the same transaction as the message
+	err = app.Messages.Insert(r.Context(), message, app.enqueueTask(taskMessageNotify, message))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// listThreadsHandler lists the authenticated user's threads with unread counts
+func (app *application) listThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	threads, err := app.Messages.GetThreadsForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	unread := 0
+	for _, thread := range threads {
+		unread += thread.Unread
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"threads": threads,
+		"unread":  unread,
+	})
+}
+
+// threadForRequest loads the application from the {id} path value and checks the
+// authenticated user is a participant: the applicant or the recruiter who owns the job.
+// Other recruiters never take part, there's no verified link between recruiters and
+// companies, anyone could post a job under a company's name.
+// It writes the error response itself and returns ok=false when the handler should stop.
+func (app *application) threadForRequest(w http.ResponseWriter, r *http.Request) (*data.JobApplication, *data.Job, int, bool) {
+	applicationId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid application ID")
+		return nil, nil, 0, false
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return nil, nil, 0, false
+	}
+
+	jobApp, job, err := app.applicationWithJob(r.Context(), applicationId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, nil, 0, false
+	}
+
+	// outsiders get the same response as a missing application
+	if userId != jobApp.UserId && userId != job.UserId {
+		app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		return nil, nil, 0, false
+	}
+
+	return jobApp, job, userId, true
+}
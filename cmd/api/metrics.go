@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/karnop/gojobs/internal/metrics"
+)
+
+// appMetrics are the metrics served on the admin listener at /metrics
+type appMetrics struct {
+	Registry *metrics.Registry
+
+	requests        *metrics.Counter
+	requestDuration *metrics.Histogram
+	inFlight        *metrics.Gauge
+
+	JobsCreated           *metrics.Counter
+	ApplicationsSubmitted *metrics.Counter
+	LoginsFailed          *metrics.Counter
+}
+
+func newMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &appMetrics{
+		Registry: reg,
+
+		// routes are labelled by their ServeMux pattern, which includes the method.
+		// raw paths would make a series per id
+		requests: reg.NewCounter("gojobs_http_requests_total",
+			"HTTP requests by route pattern and status code.", "pattern", "status"),
+		requestDuration: reg.NewHistogram("gojobs_http_request_duration_seconds",
+			"HTTP request latency by route pattern.", metrics.DefBuckets, "pattern"),
+		inFlight: reg.NewGauge("gojobs_http_requests_in_flight",
+			"HTTP requests being served right now."),
+
+		JobsCreated: reg.NewCounter("gojobs_jobs_created_total",
+			"Jobs posted by recruiters."),
+		ApplicationsSubmitted: reg.NewCounter("gojobs_applications_submitted_total",
+			"Applications submitted by candidates."),
+		LoginsFailed: reg.NewCounter("gojobs_logins_failed_total",
+			"Failed password and two-factor logins."),
+	}
+
+	registerDBStats(reg, db)
+
+	return m
+}
+
+// registerDBStats exposes the connection pool's DB.Stats, they're read on every scrape
+func registerDBStats(reg *metrics.Registry, db *sql.DB) {
+	stat := func(fn func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			return fn(db.Stats())
+		}
+	}
+
+	reg.NewGaugeFunc("gojobs_db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("gojobs_db_open_connections", "Established connections, in use and idle.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("gojobs_db_in_use_connections", "Connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("gojobs_db_idle_connections", "Idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewCounterFunc("gojobs_db_wait_count_total", "Connections waited for.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("gojobs_db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewCounterFunc("gojobs_db_max_idle_closed_total", "Connections closed because of SetMaxIdleConns.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewCounterFunc("gojobs_db_max_idle_time_closed_total", "Connections closed because of SetConnMaxIdleTime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }))
+	reg.NewCounterFunc("gojobs_db_max_lifetime_closed_total", "Connections closed because of SetConnMaxLifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
+
+// recordMetrics counts requests and times them by route
+func (app *application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.Metrics.inFlight.Inc()
+		defer app.Metrics.inFlight.Dec()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// r.Pattern is set by the mux, see logRequests. Requests that matched
+		// nothing share one series, whatever method or path they made up
+		pattern := r.Pattern
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		app.Metrics.requests.Inc(pattern, strconv.Itoa(rec.status))
+		app.Metrics.requestDuration.Observe(time.Since(start).Seconds(), pattern)
+	})
+}
+
+// adminRoutes are served on the admin listener, which must not be reachable from outside
+func (app *application) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.Metrics.Registry.Handler())
+	return mux
+}
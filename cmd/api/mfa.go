@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/totp"
+)
+
+// two-factor authentication settings
+const (
+	mfaIssuer = "GoJobs" // shown next to the account in authenticator apps
+	mfaSkew   = 1        // steps either side of now that are accepted
+)
+
+// TWO-FACTOR LOGIN
+
+// writeMFAChallenge answers a correct password for a user with two-factor authentication
+// with a short-lived challenge token instead of the JWT
+func (app *application) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *data.User) {
+	tokenString, err := app.signToken(jwt.MapClaims{
+		"sub":   user.Id,
+		"scope": scopeMFAChallenge,
+		"exp":   time.Now().Add(app.Config.Tokens.MFALifetime).Unix(),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_required": true,
+		"mfa_token":    tokenString,
+	})
+}
+
+// writeMFAEnrolmentToken answers a correct password for a recruiter who has to set up
+// two-factor authentication with a token that only works on the enrolment routes
+func (app *application) writeMFAEnrolmentToken(w http.ResponseWriter, r *http.Request, user *data.User) {
+	tokenString, err := app.signToken(jwt.MapClaims{
+		"sub":   user.Id,
+		"role":  user.Role,
+		"scope": scopeMFAEnrolment,
+		"exp":   time.Now().Add(app.Config.Tokens.MFALifetime).Unix(),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mfa_enrolment_required": true,
+		"token":                  tokenString,
+	})
+}
+
+// loginMFAHandler completes a two-factor login, exchanging the challenge token and
+// an authenticator code (or a recovery code) for the JWT
+func (app *application) loginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.MFAToken == "" || (input.Code == "" && input.RecoveryCode == "") {
+		app.errorResponse(w, r, http.StatusBadRequest, "mfa_token and a code or recovery_code required")
+		return
+	}
+
+	claims, err := app.parseToken(input.MFAToken, app.tokenAudience(scopeMFAChallenge))
+	if err != nil || claims["scope"] != scopeMFAChallenge {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired token")
+		return
+	}
+
+	userIdFloat, ok := claims["sub"].(float64)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Invalid user ID in token")
+		return
+	}
+
+	user, err := app.Users.Get(r.Context(), int(userIdFloat))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired token")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// wrong codes count as failed logins, so guessing them hits the same lockout as passwords
+	if app.mfaBlocked(w, r, user) {
+		return
+	}
+
+	valid, err := app.verifyMFA(r.Context(), user.Id, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !valid {
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.errorResponse(w, r, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	app.completeLogin(w, r, user)
+}
+
+// mfaBlocked writes a 429 when the user's email or the client IP is blocked after
+// failed logins, wrong codes are counted towards the same blocks
+func (app *application) mfaBlocked(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	wait, err := app.LoginThrottles.BlockedFor(r.Context(), emailLoginKey(user.Email), ipLoginKey(app.clientIP(r)))
+	if err != nil {
+		app.serverError(w, r, err)
+		return true
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+		app.errorResponse(w, r, http.StatusTooManyRequests, "Too many failed login attempts, please try again later")
+		return true
+	}
+	return false
+}
+
+// checkMFACode verifies the code an account change on the signed-in user asks for.
+// It's throttled like the two-factor login, otherwise a stolen token could guess
+// codes here without limit. It writes the error response itself and returns false
+// when the handler should stop
+func (app *application) checkMFACode(w http.ResponseWriter, r *http.Request, userId int, code string, recoveryCode string) bool {
+	user, err := app.Users.Get(r.Context(), userId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return false
+	}
+
+	if app.mfaBlocked(w, r, user) {
+		return false
+	}
+
+	valid, err := app.verifyMFA(r.Context(), user.Id, code, recoveryCode)
+	if err != nil {
+		app.serverError(w, r, err)
+		return false
+	}
+
+	if !valid {
+		err = app.recordLoginFailure(r, user.Email, user)
+		if err != nil {
+			app.serverError(w, r, err)
+			return false
+		}
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, "Invalid code")
+		return false
+	}
+
+	return true
+}
+
+// verifyMFA checks an authenticator code, or a recovery code when code is empty.
+// both can only be used once.
+func (app *application) verifyMFA(ctx context.Context, userId int, code string, recoveryCode string) (bool, error) {
+	if code == "" {
+		return app.MFA.UseRecoveryCode(ctx, userId, recoveryCode)
+	}
+
+	secret, err := app.MFA.GetTOTP(ctx, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrMFANotEnabled) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	step, ok := totp.Validate(secret.Secret, code, time.Now(), mfaSkew)
+	if !ok {
+		return false, nil
+	}
+
+	return app.MFA.UseStep(ctx, userId, step)
+}
+
+// TWO-FACTOR ENROLMENT HANDLERS
+
+// enrolTOTPHandler starts setting up an authenticator app. The secret isn't used
+// for logins until a code from the app confirms it was scanned.
+func (app *application) enrolTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// RBAC check
+	// these accounts can see applicants' personal data
+	user, err := app.Users.Get(r.Context(), userId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if user.Role != "recruiter" && user.Role != "admin" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only recruiters and admins can enable two-factor authentication")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.MFA.SetPendingSecret(r.Context(), user.Id, secret)
+	if err != nil {
+		if errors.Is(err, data.ErrMFAEnabled) {
+			app.errorResponse(w, r, http.StatusConflict, "Two-factor authentication is already enabled")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(mfaIssuer, user.Email, secret),
+	})
+}
+
+// confirmTOTPHandler turns two-factor authentication on once the user proves their
+// app generates the right codes, and returns the recovery codes
+func (app *application) confirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	secret, err := app.MFA.GetTOTP(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, data.ErrMFANotEnabled) {
+			app.errorResponse(w, r, http.StatusConflict, "Start enrolment with POST /users/me/mfa/totp first")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if secret.Enabled {
+		app.errorResponse(w, r, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	if !app.checkMFACode(w, r, userId, input.Code, "") {
+		return
+	}
+
+	codes, hashes := data.NewRecoveryCodes()
+
+	err = app.MFA.Enable(r.Context(), userId, hashes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Two-factor authentication enabled", "user_id", userId)
+
+	// the recovery codes are only ever shown here
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// disableTOTPHandler turns two-factor authentication off, it takes a current code
+// so a stolen token alone can't remove the second factor
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	required, err := app.MFA.Required(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if required {
+		app.errorResponse(w, r, http.StatusForbidden, "Your company requires two-factor authentication")
+		return
+	}
+
+	if !app.checkMFACode(w, r, userId, input.Code, input.RecoveryCode) {
+		return
+	}
+
+	err = app.MFA.Disable(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Two-factor authentication disabled", "user_id", userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// regenerateRecoveryCodesHandler replaces the user's recovery codes with a new set
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	secret, err := app.MFA.GetTOTP(r.Context(), userId)
+	if err != nil && !errors.Is(err, data.ErrMFANotEnabled) {
+		app.serverError(w, r, err)
+		return
+	}
+	if secret == nil || !secret.Enabled {
+		app.errorResponse(w, r, http.StatusConflict, "Two-factor authentication is not enabled")
+		return
+	}
+
+	if !app.checkMFACode(w, r, userId, input.Code, "") {
+		return
+	}
+
+	codes, hashes := data.NewRecoveryCodes()
+
+	err = app.MFA.ReplaceRecoveryCodes(r.Context(), userId, hashes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recovery_codes": codes,
+	})
+}
+
+// ADMIN HANDLERS
+
+// setCompanyMFAPolicyHandler sets whether the recruiters of a company must use two-factor authentication
+func (app *application) setCompanyMFAPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	company := r.PathValue("company")
+
+	adminId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// RBAC check
+	admin, err := app.Users.Get(r.Context(), adminId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if admin.Role != "admin" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only admins can set company policies")
+		return
+	}
+
+	var input struct {
+		Required *bool `json:"required"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Required == nil {
+		app.errorResponse(w, r, http.StatusBadRequest, `body must contain the "required" field`)
+		return
+	}
+
+	err = app.MFA.SetCompanyPolicy(r.Context(), company, *input.Required)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Company MFA policy updated", "company", company, "required", *input.Required, "admin_id", admin.Id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"company":      company,
+		"mfa_required": *input.Required,
+	})
+}
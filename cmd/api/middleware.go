@@ -2,86 +2,363 @@ package main
 
 import (
 	"context" // to store userid inside the request
+	"crypto/rand"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"math"
 	"net/http"
-	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/ratelimit"
 )
 
-// authenticate is a middleware the validates the JWT token
+// authenticate is a middleware the validates the JWT token, or an API key
+// sent as "Authorization: ApiKey <key>"
 // It wraps a standard http.HandlerFunc and returns a new http.HandlerFunc
 func (app *application) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return app.checkToken(next, false, "")
+}
+
+// authenticateOptional is authenticate for public routes
+// requests without an Authorization header pass through anonymously,
+// but a header that is present must still carry a valid token
+func (app *application) authenticateOptional(next http.HandlerFunc) http.HandlerFunc {
+	return app.checkToken(next, true, "")
+}
+
+// authenticateEnrolment is authenticate for the two-factor enrolment routes, it also
+// accepts the limited token given to users who must set up two-factor authentication
+// before they can do anything else
+func (app *application) authenticateEnrolment(next http.HandlerFunc) http.HandlerFunc {
+	return app.checkToken(next, false, scopeMFAEnrolment)
+}
+
+// checkToken does the work for the authenticate middlewares.
+// tokens with a scope claim are limited tokens, they're only accepted where scope matches.
+// Their audience differs from full tokens', see tokenAudience
+func (app *application) checkToken(next http.HandlerFunc, optional bool, scope string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// get the Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			if optional {
+				next(w, r)
+				return
+			}
+			app.errorResponse(w, r, http.StatusUnauthorized, "Authorization header required")
 			return
 		}
 
 		// removing bearer prefix to just get the token string
 		headerParts := strings.Split(authHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header format", http.StatusUnauthorized)
+		if len(headerParts) != 2 || (headerParts[0] != "Bearer" && headerParts[0] != "ApiKey") {
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid authorization header format")
 			return
 		}
 		tokenString := headerParts[1]
 
-		// parse and validate the token
-		// we will pass a callback function that return the secret key to the parser
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// validating that signing method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		// API keys never carry a limited scope, so they're checked separately
+		if headerParts[0] == "ApiKey" {
+			if scope != "" {
+				app.errorResponse(w, r, http.StatusForbidden, "This endpoint cannot be used with an API key")
+				return
 			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+			app.checkAPIKey(next, w, r, tokenString)
+			return
+		}
 
-		// checking if parsing failed
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		// parse and validate the token. Full tokens work everywhere, a limited
+		// token only where its scope is expected, each has its own audience
+		tokenScope := ""
+		claims, err := app.parseToken(tokenString, app.tokenAudience(""))
+		if err != nil && scope != "" {
+			tokenScope = scope
+			claims, err = app.parseToken(tokenString, app.tokenAudience(scope))
+		}
+		if err != nil {
+			// tell a recruiter with an enrolment token what it is for
+			if _, enrolErr := app.parseToken(tokenString, app.tokenAudience(scopeMFAEnrolment)); enrolErr == nil {
+				app.errorResponse(w, r, http.StatusForbidden, "Two-factor authentication must be set up first")
+				return
+			}
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
-		// extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		// the scope claim has to agree with the audience
+		if claimScope, _ := claims["scope"].(string); claimScope != tokenScope {
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired token")
 			return
 		}
 
 		// getting the user id from claims
 		userIdFloat, ok := claims["sub"].(float64)
 		if !ok {
-			http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+			app.errorResponse(w, r, http.StatusUnauthorized, "Invalid user ID in token")
 			return
 		}
 		userId := int(userIdFloat)
 
 		// adding user id to request context
-		ctx := context.WithValue(r.Context(), "userId", userId)
+		ctx := setRequestUser(r, userId)
+
+		// full tokens belong to a session, which is gone once the user logs out of it
+		if tokenScope == "" {
+			sessionIdFloat, ok := claims["sid"].(float64)
+			if !ok {
+				app.errorResponse(w, r, http.StatusUnauthorized, "Invalid or expired token")
+				return
+			}
+			sessionId := int(sessionIdFloat)
+
+			active, err := app.Sessions.Active(ctx, sessionId, userId)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			if !active {
+				app.errorResponse(w, r, http.StatusUnauthorized, "Session has been logged out")
+				return
+			}
+
+			app.SessionTracker.Seen(sessionId)
+			ctx = context.WithValue(ctx, "sessionId", sessionId)
+		}
 
 		next(w, r.WithContext(ctx))
 	}
 }
 
-func (app *application) enableCORS(next http.Handler) http.Handler {
+// requestID gives every request an id, returned in X-Request-ID and included in error
+// responses and logs. An id sent by the client or a proxy is kept if it looks sane,
+// so a request can be followed across services.
+// The request's logger, see logging.FromContext, is tagged with the id here
+func (app *application) requestID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// setting the headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		// handling Preflight Requests (OPTIONS)
-		// Browsers send a "test" request (OPTIONS) before the real POST request.
-		// We must answer "OK" to this test immediately.
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), "requestId", id)
+		ctx = context.WithValue(ctx, "requestInfo", &requestInfo{})
+		ctx = logging.NewContext(ctx, app.Logger.With("request_id", id))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts up to 128 letters, digits, dashes, underscores and dots,
+// anything else could smuggle odd characters into logs and headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
 		}
+	}
+	return true
+}
+
+// requestInfo collects what the access log and traces need to know from further down the chain
+type requestInfo struct {
+	userId int
+}
+
+// responseRecorder remembers the status and size of a response for the access log
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the real writer, e.g. to flush
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequests writes one access log line for every request once it's done
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		// the middlewares below pass r on as it is, so the mux sets the pattern
+		// it matched on this request. It's empty when nothing matched
+		attrs := []interface{}{
+			"method", r.Method,
+			"pattern", r.Pattern,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if info, ok := r.Context().Value("requestInfo").(*requestInfo); ok && info.userId != 0 {
+			attrs = append(attrs, "user_id", info.userId)
+		}
+
+		logging.FromContext(r.Context()).Info("Request", attrs...)
+	})
+}
+
+// setRequestUser records the authenticated user in the request's context,
+// for the handlers, the access log and the request's logger
+func setRequestUser(r *http.Request, userId int) context.Context {
+	if info, ok := r.Context().Value("requestInfo").(*requestInfo); ok {
+		info.userId = userId
+	}
+
+	ctx := context.WithValue(r.Context(), "userId", userId)
+	return logging.With(ctx, "user_id", userId)
+}
+
+// recoverPanic turns a panic in a handler into a 500 and logs it with its stack,
+// instead of the server dropping the connection without a word
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// handlers panic with ErrAbortHandler on purpose to drop the connection
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			logging.FromContext(r.Context()).Error("Panic",
+				"method", r.Method,
+				"url", r.URL.String(),
+				"error", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+
+			// too late for an error response once the handler started writing
+			if rec, ok := w.(*responseRecorder); ok && rec.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			w.Header().Set("Connection", "close")
+			app.errorResponse(w, r, http.StatusInternalServerError, "The server encountered a problem and could not process your request")
+		}()
 
-		// passing down to the next handler
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// unmatchedRoutes answers requests no route matches with a problem response instead
+// of the mux's plain text one: a 405 with its Allow header when only the method is
+// wrong, a 404 otherwise
+func (app *application) unmatchedRoutes(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// the mux's own answer has the status and the methods the path does have
+		answer := &muxAnswer{header: make(http.Header), status: http.StatusOK}
+		h.ServeHTTP(answer, r)
+
+		if answer.status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", answer.header.Get("Allow"))
+			app.errorResponse(w, r, http.StatusMethodNotAllowed, "This method is not allowed for the requested resource")
+			return
+		}
+		app.errorResponse(w, r, http.StatusNotFound, "The requested resource could not be found")
+	})
+}
+
+// muxAnswer keeps the headers and status of a response and drops its body
+type muxAnswer struct {
+	header http.Header
+	status int
+}
+
+func (a *muxAnswer) Header() http.Header         { return a.header }
+func (a *muxAnswer) Write(b []byte) (int, error) { return len(b), nil }
+func (a *muxAnswer) WriteHeader(status int)      { a.status = status }
+
+// rate limits, the stricter route limits apply on top of the default one
+var (
+	defaultRateLimit  = ratelimit.Limit{Rate: 10, Burst: 60} // per IP, every route
+	loginRateLimit    = ratelimit.Per(10, 15*time.Minute)    // per IP, slows down password guessing
+	registerRateLimit = ratelimit.Per(5, time.Hour)          // per IP, stops sign-up spam
+	applyRateLimit    = ratelimit.Per(30, time.Hour)         // per user
+)
+
+// rateLimitAll applies the default rate limit to every request
+func (app *application) rateLimitAll(next http.Handler) http.Handler {
+	return app.rateLimit("global", defaultRateLimit, next.ServeHTTP)
+}
+
+// rateLimit lets through at most limit requests to next. Requests are counted per user
+// when authenticate ran first and per client IP otherwise, name keeps the buckets of
+// different routes apart.
+func (app *application) rateLimit(name string, limit ratelimit.Limit, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.RateLimiter == nil {
+			next(w, r)
+			return
+		}
+
+		key := name + ":ip:" + app.clientIP(r)
+		if userId, ok := r.Context().Value("userId").(int); ok {
+			key = fmt.Sprintf("%s:user:%d", name, userId)
+		}
+
+		res, err := app.RateLimiter.Take(r.Context(), key, limit)
+		if err != nil {
+			// fail open, the store being down shouldn't take the API down with it
+			logging.FromContext(r.Context()).Error("Rate limiter failed", "key", key, "error", err)
+			next(w, r)
+			return
+		}
+
+		// RateLimit-* headers as described in the IETF httpapi ratelimit headers draft
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Window())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			app.errorResponse(w, r, http.StatusTooManyRequests, "Too many requests, please try again later")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds for headers
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
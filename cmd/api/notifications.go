@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/worker"
+)
+
+// NOTIFICATION PREFERENCE HANDLERS
+
+// getNotificationPreferencesHandler shows which emails the user receives
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	prefs, err := app.NotificationPreferences.Get(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// updateNotificationPreferencesHandler turns individual emails on or off,
+// fields left out of the request keep their current value
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// pointers tell a missing field apart from false
+	var input struct {
+		ApplicationReceived *bool `json:"application_received"`
+		ApplicationStatus   *bool `json:"application_status"`
+		NewApplicant        *bool `json:"new_applicant"`
+		NewMessage          *bool `json:"new_message"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	prefs, err := app.NotificationPreferences.Get(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if input.ApplicationReceived != nil {
+		prefs.ApplicationReceived = *input.ApplicationReceived
+	}
+	if input.ApplicationStatus != nil {
+		prefs.ApplicationStatus = *input.ApplicationStatus
+	}
+	if input.NewApplicant != nil {
+		prefs.NewApplicant = *input.NewApplicant
+	}
+	if input.NewMessage != nil {
+		prefs.NewMessage = *input.NewMessage
+	}
+
+	err = app.NotificationPreferences.Upsert(r.Context(), prefs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// NOTIFICATION TASKS
+
+// notifyMessageTask emails the participant who received a message
+func (app *application) notifyMessageTask(ctx context.Context, task *worker.Task) error {
+	var message data.Message
+	err := task.Decode(&message)
+	if err != nil {
+		return err
+	}
+
+	jobApp, job, err := app.applicationWithJob(ctx, message.ApplicationId)
+	if err != nil {
+		return err
+	}
+
+	// the recipient is whichever participant didn't send the message
+	recipientId := job.UserId
+	if message.SenderId == job.UserId {
+		recipientId = jobApp.UserId
+	}
+
+	return app.notify(ctx, recipientId, func(p *data.NotificationPreferences) bool { return p.NewMessage }, "new_message.tmpl", map[string]interface{}{
+		"JobTitle": job.Title,
+		"Company":  job.Company,
+		"Body":     message.Body,
+		"URL":      fmt.Sprintf("%s/applications/%d/messages", app.Config.BaseURL, jobApp.Id),
+	})
+}
+
+// notifyApplicationReceivedTask confirms a new application to the candidate
+func (app *application) notifyApplicationReceivedTask(ctx context.Context, task *worker.Task) error {
+	var jobApp data.JobApplication
+	err := task.Decode(&jobApp)
+	if err != nil {
+		return err
+	}
+
+	job, err := app.Jobs.Get(ctx, jobApp.JobId)
+	if err != nil {
+		return err
+	}
+
+	return app.notify(ctx, jobApp.UserId, func(p *data.NotificationPreferences) bool { return p.ApplicationReceived }, "application_received.tmpl", map[string]interface{}{
+		"JobTitle": job.Title,
+		"Company":  job.Company,
+	})
+}
+
+// notifyNewApplicantTask tells the recruiter about a new application to their job.
+// it's a task of its own so a retry after a failed send doesn't email the candidate twice
+func (app *application) notifyNewApplicantTask(ctx context.Context, task *worker.Task) error {
+	var jobApp data.JobApplication
+	err := task.Decode(&jobApp)
+	if err != nil {
+		return err
+	}
+
+	job, err := app.Jobs.Get(ctx, jobApp.JobId)
+	if err != nil {
+		return err
+	}
+
+	candidate, err := app.Users.Get(ctx, jobApp.UserId)
+	if err != nil {
+		return err
+	}
+
+	return app.notify(ctx, job.UserId, func(p *data.NotificationPreferences) bool { return p.NewApplicant }, "new_applicant.tmpl", map[string]interface{}{
+		"CandidateName": candidate.Name,
+		"JobTitle":      job.Title,
+		"URL":           fmt.Sprintf("%s/applications/%d/messages", app.Config.BaseURL, jobApp.Id),
+	})
+}
+
+// splitApplicationNotifyTask turns a task queued before the two emails had their own
+// tasks into those two, both queued or neither
+func (app *application) splitApplicationNotifyTask(ctx context.Context, task *worker.Task) error {
+	var jobApp data.JobApplication
+	err := task.Decode(&jobApp)
+	if err != nil {
+		return err
+	}
+
+	tx, err := app.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, kind := range []string{taskApplicationReceivedNotify, taskNewApplicantNotify} {
+		err = worker.Enqueue(ctx, tx, kind, jobApp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// notifyApplicationStatusTask tells the candidate their application changed status
+func (app *application) notifyApplicationStatusTask(ctx context.Context, task *worker.Task) error {
+	var jobApp data.JobApplication
+	err := task.Decode(&jobApp)
+	if err != nil {
+		return err
+	}
+
+	job, err := app.Jobs.Get(ctx, jobApp.JobId)
+	if err != nil {
+		return err
+	}
+
+	return app.notify(ctx, jobApp.UserId, func(p *data.NotificationPreferences) bool { return p.ApplicationStatus }, "application_status.tmpl", map[string]interface{}{
+		"JobTitle": job.Title,
+		"Company":  job.Company,
+		"Status":   jobApp.Status,
+		"URL":      fmt.Sprintf("%s/applications/%d/offers", app.Config.BaseURL, jobApp.Id),
+	})
+}
+
+// notify emails a user if their preferences allow it.
+// the recipient's name is added to the template data as "Name"
+func (app *application) notify(ctx context.Context, userId int, wanted func(*data.NotificationPreferences) bool, templateFile string, templateData map[string]interface{}) error {
+	prefs, err := app.NotificationPreferences.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !wanted(prefs) {
+		return nil
+	}
+
+	user, err := app.Users.Get(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	templateData["Name"] = user.Name
+
+	return app.Mailer.Send(ctx, user.Email, templateFile, templateData)
+}
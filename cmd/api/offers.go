@@ -0,0 +1,415 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// OFFER HANDLERS
+
+// createOfferHandler lets the recruiter who owns the job draft an offer on an application
+func (app *application) createOfferHandler(w http.ResponseWriter, r *http.Request) {
+	applicationId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid application ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Salary    int       `json:"salary"`
+		Currency  string    `json:"currency"`
+		StartDate string    `json:"start_date"` // YYYY-MM-DD
+		ExpiresAt time.Time `json:"expires_at"`
+		Terms     string    `json:"terms"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jobApp, job, err := app.applicationWithJob(r.Context(), applicationId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// only the recruiter who posted the job can make offers on it
+	if job.UserId != userId {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the job's recruiter can make offers")
+		return
+	}
+
+	// no new offers once the candidate is hired, rejected or has declined
+	if jobApp.Status != data.StatusApplied && jobApp.Status != data.StatusInterviewing {
+		app.errorResponse(w, r, http.StatusConflict, "Application is not open for offers")
+		return
+	}
+
+	offer := &data.Offer{
+		ApplicationId: applicationId,
+		Salary:        input.Salary,
+		Currency:      strings.ToUpper(input.Currency),
+		ExpiresAt:     input.ExpiresAt,
+		Terms:         input.Terms,
+	}
+
+	v := validator.New()
+
+	if input.StartDate != "" {
+		offer.StartDate, err = time.Parse(time.DateOnly, input.StartDate)
+		if err != nil {
+			v.AddError("start_date", "must be a date in YYYY-MM-DD format")
+		}
+	}
+
+	data.ValidateOffer(v, offer)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.Offers.Insert(r.Context(), offer)
+	if err != nil {
+		if errors.Is(err, data.ErrOpenOfferExists) {
+			app.errorResponse(w, r, http.StatusConflict, "An open offer already exists for this application")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(offer)
+}
+
+// listOffersHandler lists the offers on an application for the candidate or the recruiter
+func (app *application) listOffersHandler(w http.ResponseWriter, r *http.Request) {
+	applicationId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid application ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	jobApp, job, err := app.applicationWithJob(r.Context(), applicationId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if userId != jobApp.UserId && userId != job.UserId {
+		app.errorResponse(w, r, http.StatusNotFound, "Application not found")
+		return
+	}
+
+	offers, err := app.Offers.GetAllForApplication(r.Context(), applicationId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// candidates don't see drafts the recruiter is still working on, or dropped
+	if userId == jobApp.UserId {
+		visible := []*data.Offer{}
+		for _, offer := range offers {
+			if candidateCanSee(offer) {
+				visible = append(visible, offer)
+			}
+		}
+		offers = visible
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"offers": offers,
+	})
+}
+
+// getOfferHandler shows a single offer to the candidate or the recruiter
+func (app *application) getOfferHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.offerForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.role == offerCandidate && !candidateCanSee(req.offer) {
+		app.errorResponse(w, r, http.StatusNotFound, "Offer not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req.offer)
+}
+
+// sendOfferHandler sends a draft offer to the candidate
+func (app *application) sendOfferHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.offerForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.role != offerRecruiter {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the job's recruiter can send offers")
+		return
+	}
+
+	app.transitionOffer(w, r, req, app.Offers.Send)
+}
+
+// withdrawOfferHandler lets the recruiter drop a draft offer, e.g. one that
+// expired before it was sent, so a new offer can be made on the application
+func (app *application) withdrawOfferHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.offerForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.role != offerRecruiter {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the job's recruiter can withdraw offers")
+		return
+	}
+
+	err := app.Offers.Withdraw(r.Context(), req.offer)
+	if err != nil {
+		if errors.Is(err, data.ErrOfferNotOpen) {
+			app.errorResponse(w, r, http.StatusConflict, "Only draft offers can be withdrawn")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Offer withdrawn",
+		"offer_id", req.offer.Id,
+		"application_id", req.offer.ApplicationId,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req.offer)
+}
+
+// acceptOfferHandler lets the candidate accept a sent offer
+func (app *application) acceptOfferHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.offerForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.role != offerCandidate {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the candidate can accept an offer")
+		return
+	}
+
+	app.transitionOffer(w, r, req, app.Offers.Accept)
+}
+
+// declineOfferHandler lets the candidate decline a sent offer
+func (app *application) declineOfferHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := app.offerForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.role != offerCandidate {
+		app.errorResponse(w, r, http.StatusForbidden, "Only the candidate can decline an offer")
+		return
+	}
+
+	app.transitionOffer(w, r, req, app.Offers.Decline)
+}
+
+// candidateCanSee reports whether the candidate may see an offer, drafts are
+// the recruiter's own until they're sent
+func candidateCanSee(offer *data.Offer) bool {
+	return offer.Status != data.OfferDraft && offer.Status != data.OfferWithdrawn
+}
+
+// which side of an offer the current user is on
+const (
+	offerCandidate = "candidate"
+	offerRecruiter = "recruiter"
+)
+
+// offerRequest is an offer loaded for a request along with what it belongs to
+type offerRequest struct {
+	offer       *data.Offer
+	application *data.JobApplication
+	job         *data.Job
+	role        string // offerCandidate or offerRecruiter
+}
+
+// offerForRequest loads the offer from the {id} path value and works out whether
+// the authenticated user is its candidate or recruiter.
+// It writes the error response itself and returns ok=false when the handler should stop.
+func (app *application) offerForRequest(w http.ResponseWriter, r *http.Request) (*offerRequest, bool) {
+	offerId, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid offer ID")
+		return nil, false
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	offer, err := app.Offers.Get(r.Context(), offerId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Offer not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	jobApp, job, err := app.applicationWithJob(r.Context(), offer.ApplicationId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	req := &offerRequest{offer: offer, application: jobApp, job: job}
+
+	switch userId {
+	case job.UserId:
+		req.role = offerRecruiter
+		return req, true
+	case jobApp.UserId:
+		req.role = offerCandidate
+		return req, true
+	}
+
+	// don't reveal offers to anyone else
+	app.errorResponse(w, r, http.StatusNotFound, "Offer not found")
+	return nil, false
+}
+
+// transitionOffer applies a state change to an offer and writes the updated offer
+func (app *application) transitionOffer(w http.ResponseWriter, r *http.Request, req *offerRequest, change func(context.Context, *data.Offer, ...data.TxFunc) error) {
+	offer := req.offer
+
+	// every offer transition moves the application along with it,
+	// the hook runs after the change so the status is known by then
+	jobApp := req.application
+	statusChanged := app.emitEvent(req.job.UserId, data.EventApplicationStatusChanged, jobApp)
+	notifyCandidate := app.enqueueTask(taskApplicationStatusNotify, jobApp)
+
+	err := change(r.Context(), offer, func(ctx context.Context, tx *sql.Tx) error {
+		jobApp.Status = offerApplicationStatus[offer.Status]
+
+		err := statusChanged(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return notifyCandidate(ctx, tx)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOfferNotOpen):
+			app.errorResponse(w, r, http.StatusConflict, "Offer is not open for this action")
+		case errors.Is(err, data.ErrApplicationNotOpen):
+			app.errorResponse(w, r, http.StatusConflict, "Application is not open for offers")
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Offer updated",
+		"offer_id", offer.Id,
+		"application_id", offer.ApplicationId,
+		"status", offer.Status,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// offerApplicationStatus maps an offer's new status to the application status it results in
+var offerApplicationStatus = map[string]string{
+	data.OfferSent:     data.StatusOffered,
+	data.OfferAccepted: data.StatusHired,
+	data.OfferDeclined: data.StatusDeclined,
+	data.OfferExpired:  data.StatusInterviewing,
+}
+
+// applicationWithJob fetches an application along with the job it was made for
+func (app *application) applicationWithJob(ctx context.Context, applicationId int) (*data.JobApplication, *data.Job, error) {
+	jobApp, err := app.Applications.Get(ctx, applicationId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	job, err := app.Jobs.Get(ctx, jobApp.JobId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jobApp, job, nil
+}
+
+// expireOffers expires sent offers that passed their deadline, the worker calls it every minute
+func (app *application) expireOffers(ctx context.Context) error {
+	return app.Offers.ExpireDue(ctx, func(ctx context.Context, tx *sql.Tx, applicationIds []int) error {
+		app.Logger.Info("Offers expired", "applications_reverted", len(applicationIds))
+
+		for _, id := range applicationIds {
+			// read in the transaction, the event carries the row as it will be committed
+			jobApp, err := app.Applications.GetTx(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+
+			job, err := app.Jobs.Get(ctx, jobApp.JobId)
+			if err != nil {
+				return err
+			}
+
+			err = app.emitEvent(job.UserId, data.EventApplicationStatusChanged, jobApp)(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			err = app.enqueueTask(taskApplicationStatusNotify, jobApp)(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/oidc"
+)
+
+// scopeOIDCState marks the signed cookie that carries an OpenID Connect login between redirects,
+// it gets its own audience like the limited tokens
+const scopeOIDCState = "oidc_state"
+
+// oidcLoginTimeout is how long the user has to finish logging in at the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// SOCIAL LOGIN HANDLERS
+
+// oidcLoginHandler starts an authorization code flow with PKCE, sending the user to the provider
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	provider, ok := app.OIDCProviders[name]
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+
+	state := oidc.NewVerifier()
+	nonce := oidc.NewVerifier()
+	verifier := oidc.NewVerifier()
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the flow's secrets travel in a signed cookie, so any API instance can handle the callback
+	// and the state can only be completed by the browser that started it
+	cookie, err := app.signToken(jwt.MapClaims{
+		"scope":    scopeOIDCState,
+		"provider": name,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcLoginTimeout).Unix(),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, app.oidcCookie(name, cookie, int(oidcLoginTimeout.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes the flow when the provider sends the user back,
+// logging them in to the user linked to their provider account
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	provider, ok := app.OIDCProviders[name]
+	if !ok {
+		app.errorResponse(w, r, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+
+	// the cookie is single use
+	http.SetCookie(w, app.oidcCookie(name, "", -1))
+
+	qs := r.URL.Query()
+	if qs.Get("error") != "" {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Login cancelled or refused by the provider")
+		return
+	}
+
+	cookie, err := r.Cookie("oidc_" + name)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Login session expired, please start again")
+		return
+	}
+
+	claims, err := app.parseToken(cookie.Value, app.tokenAudience(scopeOIDCState))
+	if err != nil || claims["scope"] != scopeOIDCState || claims["provider"] != name {
+		app.errorResponse(w, r, http.StatusBadRequest, "Login session expired, please start again")
+		return
+	}
+
+	if qs.Get("state") == "" || claims["state"] != qs.Get("state") {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+
+	identity, err := provider.Exchange(r.Context(), qs.Get("code"), verifier, nonce)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("OIDC login failed", "provider", name, "error", err.Error())
+		app.errorResponse(w, r, http.StatusUnauthorized, "Login with the provider failed")
+		return
+	}
+
+	user, err := app.userForIdentity(r.Context(), name, identity)
+	if err != nil {
+		if errors.Is(err, errUnverifiedEmail) {
+			app.errorResponse(w, r, http.StatusForbidden, "The provider did not confirm a verified email address")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.finishLogin(w, r, user)
+}
+
+var errUnverifiedEmail = errors.New("provider email not verified")
+
+// userForIdentity returns the user linked to a provider account. The first login
+// links it to the user with the same email, creating a candidate if there is none,
+// but only when the provider verified the email.
+func (app *application) userForIdentity(ctx context.Context, provider string, identity *oidc.Claims) (*data.User, error) {
+	user, err := app.Identities.GetUser(ctx, provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email, ok := identity.VerifiedEmail()
+	if !ok {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err = app.Users.GetByEmail(ctx, email)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		user, err = app.createIdentityUser(ctx, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.Identities.Insert(ctx, &data.Identity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		UserId:   user.Id,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	app.Logger.Info("Identity linked", "user_id", user.Id, "provider", provider)
+
+	return user, nil
+}
+
+// createIdentityUser registers a candidate for someone who signed up through a provider.
+// they get a random password nobody knows, so they can only log in through the provider
+func (app *application) createIdentityUser(ctx context.Context, identity *oidc.Claims) (*data.User, error) {
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user := &data.User{
+		Name:  name,
+		Email: identity.Email,
+		Role:  "candidate",
+	}
+
+	err := user.Password.Set(rand.Text())
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.Users.Insert(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// oidcCookie builds the cookie holding a provider's login state, maxAge < 0 deletes it
+func (app *application) oidcCookie(provider string, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     "oidc_" + provider,
+		Value:    value,
+		Path:     "/auth/" + provider,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(app.Config.BaseURL, "https://"),
+		// Lax lets the cookie through on the provider's top-level redirect back to us
+		SameSite: http.SameSiteLaxMode,
+	}
+}
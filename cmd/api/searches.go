@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/validator"
+	"github.com/karnop/gojobs/internal/worker"
+)
+
+// SAVED SEARCH HANDLERS
+
+// createSavedSearchHandler saves a named set of GET /jobs parameters for the user
+func (app *application) createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var input struct {
+		Name      string            `json:"name"`
+		Params    map[string]string `json:"params"`
+		Frequency string            `json:"frequency"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	search := &data.SavedSearch{
+		UserId:    userId,
+		Name:      input.Name,
+		Params:    input.Params,
+		Frequency: input.Frequency,
+	}
+	if search.Frequency == "" {
+		search.Frequency = data.FrequencyDaily
+	}
+
+	v := validator.New()
+	data.ValidateSavedSearch(v, search)
+
+	// the params must be ones GET /jobs understands, pagination is decided by the alert
+	for key := range search.Params {
+		if !slices.Contains(jobSearchParams, key) {
+			v.AddError("params", fmt.Sprintf("unknown parameter %q", key))
+		}
+	}
+	app.readJobSearch(search.Query(), v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.SavedSearches.Insert(r.Context(), search)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(search)
+}
+
+// listSavedSearchesHandler lists the user's saved searches
+func (app *application) listSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	searches, err := app.SavedSearches.GetAllForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"saved_searches": searches,
+	})
+}
+
+// deleteSavedSearchHandler removes one of the user's saved searches
+func (app *application) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid saved search ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.SavedSearches.Delete(r.Context(), id, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Saved search not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribePage is what a browser following the link in an alert email gets.
+// Mail scanners and link previews open links too, so the page only asks, the form
+// POSTs back to the same URL like an RFC 8058 one-click unsubscribe does
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!doctype html>
+<html>
+<head>
+    <meta name="viewport" content="width=device-width" />
+    <meta http-equiv="Content-Type" content="text/html; charset=UTF-8" />
+    <title>Unsubscribe</title>
+</head>
+<body>
+    {{if .Done}}
+    <p>You will no longer receive alerts for <strong>{{.Name}}</strong>.</p>
+    {{else}}
+    <p>Stop receiving job alerts for <strong>{{.Name}}</strong>?</p>
+    <form method="post">
+        <input type="hidden" name="List-Unsubscribe" value="One-Click" />
+        <button type="submit">Unsubscribe</button>
+    </form>
+    {{end}}
+</body>
+</html>
+`))
+
+// unsubscribePolicy lets the page submit its form to itself, and nothing else
+const unsubscribePolicy = "default-src 'none'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+// unsubscribeConfirmHandler shows which search the token in an alert email is for
+// and asks before turning its alerts off. it's public and changes nothing
+func (app *application) unsubscribeConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "Missing unsubscribe token")
+		return
+	}
+
+	search, err := app.SavedSearches.GetByUnsubscribeToken(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Invalid unsubscribe token")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.writeUnsubscribePage(w, r, search, false)
+}
+
+// unsubscribeHandler turns off alerts for a saved search using the token from the email.
+// it's public, mail clients POST here for one-click unsubscribe (RFC 8058), as does
+// the confirmation page
+func (app *application) unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.errorResponse(w, r, http.StatusBadRequest, "Missing unsubscribe token")
+		return
+	}
+
+	search, err := app.SavedSearches.Unsubscribe(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Invalid unsubscribe token")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// the form on the confirmation page wants a page back
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		app.writeUnsubscribePage(w, r, search, true)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("You will no longer receive alerts for %q", search.Name),
+	})
+}
+
+func (app *application) writeUnsubscribePage(w http.ResponseWriter, r *http.Request, search *data.SavedSearch, done bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", unsubscribePolicy)
+
+	err := unsubscribePage.Execute(w, map[string]interface{}{
+		"Name": search.Name,
+		"Done": done,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Cannot render unsubscribe page", "error", err)
+	}
+}
+
+// JOB ALERTS
+
+// alert settings
+const (
+	alertDigestSize = 50 // the most jobs listed in a single alert email
+	// how old a job must be before alerts include it, see JobModel.MaxSettledId.
+	// posting a job takes a few seconds at most
+	alertSettleDelay = time.Minute
+)
+
+// sendJobAlerts queues an email for each saved search that is due, listing the jobs
+// posted since its last run. the worker calls it every minute
+func (app *application) sendJobAlerts(ctx context.Context) error {
+	// everything up to this id is covered by this round, later jobs wait for the next one
+	maxId, err := app.Jobs.MaxSettledId(ctx, alertSettleDelay)
+	if err != nil {
+		return err
+	}
+
+	searches, err := app.SavedSearches.GetDue(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, search := range searches {
+		// instant searches are due every round, skip the write when nothing was posted
+		if search.LastJobId >= maxId && search.Frequency == data.FrequencyInstant {
+			continue
+		}
+
+		lastId, hooks, err := app.nextJobAlert(ctx, search, maxId)
+		if err != nil {
+			// leave the search as it is so the next round retries it
+			app.Logger.Error("Job alert failed", "saved_search_id", search.Id, "error", err)
+			continue
+		}
+
+		// the email is queued in the same transaction, so it's sent once the run is
+		// recorded and never for a run that wasn't
+		err = app.SavedSearches.MarkRun(ctx, search, lastId, hooks...)
+		if err != nil {
+			if errors.Is(err, data.ErrRecordNotFound) {
+				// deleted, or another instance handled it this round
+				continue
+			}
+			app.Logger.Error("Job alert failed", "saved_search_id", search.Id, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// nextJobAlert finds the digest of new jobs for one saved search. It returns the id alerts
+// for the search are done up to: maxId, or the last job in a full digest, the jobs after
+// it go in the next one. And the hook that queues the email, if there are any jobs
+func (app *application) nextJobAlert(ctx context.Context, search *data.SavedSearch, maxId int) (int, []data.TxFunc, error) {
+	if search.LastJobId >= maxId {
+		return search.LastJobId, nil, nil
+	}
+
+	// the saved params were validated when the search was created.
+	// oldest first, so a full digest ends at the job to carry on after
+	input := app.readJobSearch(search.Query(), validator.New())
+	input.Filters.Page = 1
+	input.Filters.PageSize = alertDigestSize
+	input.Filters.Sort = "id"
+
+	jobs, err := app.Jobs.GetNewMatches(ctx, input.Title, input.Company, search.LastJobId, maxId, input.Filters)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(jobs) == 0 {
+		return maxId, nil, nil
+	}
+
+	lastId := maxId
+	if len(jobs) == alertDigestSize {
+		lastId = jobs[len(jobs)-1].Id
+	}
+
+	// each job links to its GET /jobs/{id}
+	alert := jobAlert{
+		UserId:           search.UserId,
+		SearchName:       search.Name,
+		UnsubscribeToken: search.UnsubscribeToken,
+		Jobs:             make([]map[string]string, len(jobs)),
+	}
+	for i, job := range jobs {
+		alert.Jobs[i] = map[string]string{
+			"Title":   job.Title,
+			"Company": job.Company,
+			"URL":     fmt.Sprintf("%s/jobs/%d", app.Config.BaseURL, job.Id),
+		}
+	}
+
+	return lastId, []data.TxFunc{app.enqueueTask(taskJobAlertNotify, alert)}, nil
+}
+
+// jobAlert is the payload of the job alert email task
+type jobAlert struct {
+	UserId           int                 `json:"user_id"`
+	SearchName       string              `json:"search_name"`
+	UnsubscribeToken string              `json:"unsubscribe_token"`
+	Jobs             []map[string]string `json:"jobs"`
+}
+
+// notifyJobAlertTask emails a saved search's digest of new jobs.
+// the search's frequency decides these, not the notification preferences
+func (app *application) notifyJobAlertTask(ctx context.Context, task *worker.Task) error {
+	var alert jobAlert
+	err := task.Decode(&alert)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.Users.Get(ctx, alert.UserId)
+	if err != nil {
+		return err
+	}
+
+	return app.Mailer.Send(ctx, user.Email, "job_alert.tmpl", map[string]interface{}{
+		"Name":           user.Name,
+		"SearchName":     alert.SearchName,
+		"Jobs":           alert.Jobs,
+		"UnsubscribeURL": fmt.Sprintf("%s/saved-searches/unsubscribe?token=%s", app.Config.BaseURL, url.QueryEscape(alert.UnsubscribeToken)),
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/logging"
+)
+
+// sessionFlushInterval is how often last seen times are written to the database
+const sessionFlushInterval = 30 * time.Second
+
+// sessionTracker collects when sessions were last used and writes them in batches,
+// so an authenticated request costs a map write instead of an UPDATE
+type sessionTracker struct {
+	sessions data.SessionModel
+	logger   *slog.Logger
+
+	mu   sync.Mutex
+	seen map[int]time.Time
+}
+
+func newSessionTracker(sessions data.SessionModel, logger *slog.Logger) *sessionTracker {
+	return &sessionTracker{
+		sessions: sessions,
+		logger:   logger,
+		seen:     make(map[int]time.Time),
+	}
+}
+
+// Seen records that a session was just used
+func (t *sessionTracker) Seen(id int) {
+	t.mu.Lock()
+	t.seen[id] = time.Now()
+	t.mu.Unlock()
+}
+
+// Run flushes every sessionFlushInterval until ctx is cancelled, then flushes once more
+func (t *sessionTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(sessionFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.flush(ctx)
+		case <-ctx.Done():
+			t.flush(context.Background())
+			return
+		}
+	}
+}
+
+func (t *sessionTracker) flush(ctx context.Context) {
+	t.mu.Lock()
+	seen := t.seen
+	t.seen = make(map[int]time.Time)
+	t.mu.Unlock()
+
+	err := t.sessions.Touch(ctx, seen)
+	if err != nil {
+		// last seen times are informational, losing a batch is fine
+		t.logger.Error("Cannot update session last seen times", "sessions", len(seen), "error", err)
+	}
+}
+
+// startSession records a login, the session's id goes in the token
+func (app *application) startSession(r *http.Request, user *data.User) (*data.Session, error) {
+	session := &data.Session{
+		UserId:    user.Id,
+		IP:        app.clientIP(r),
+		UserAgent: r.UserAgent(),
+		ExpiresAt: time.Now().Add(app.Config.Tokens.SessionLifetime),
+	}
+
+	err := app.Sessions.Insert(r.Context(), session)
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// SESSION HANDLERS
+
+// listSessionsHandler lists the devices the user is logged in on
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	sessions, err := app.Sessions.GetAllForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	currentId, _ := r.Context().Value("sessionId").(int)
+	for _, session := range sessions {
+		session.Current = session.Id == currentId
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+	})
+}
+
+// deleteSessionHandler logs the user out on one device, its token stops working straight away
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.Sessions.Delete(r.Context(), id, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Session not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("Session revoked", "user_id", userId, "session_id", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteAllSessionsHandler logs the user out everywhere, including the session making the request
+func (app *application) deleteAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err := app.Sessions.DeleteAllForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	logging.FromContext(r.Context()).Info("All sessions revoked", "user_id", userId)
+
+	w.WriteHeader(http.StatusNoContent)
+}
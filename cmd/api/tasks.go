@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/ratelimit"
+	"github.com/karnop/gojobs/internal/worker"
+)
+
+// task kinds handled by the worker
+const (
+	taskMessageNotify             = "message.notify"
+	taskApplicationNotify         = "application.notify" // queued by older versions, split into the two below
+	taskApplicationReceivedNotify = "application.received.notify"
+	taskNewApplicantNotify        = "application.new_applicant.notify"
+	taskApplicationStatusNotify   = "application.status.notify"
+	taskAccountLockedNotify       = "account.locked.notify"
+	taskNewLoginNotify            = "login.new_device.notify"
+	taskJobAlertNotify            = "saved_search.alert.notify"
+)
+
+// registerTasks wires the task handlers and periodic jobs into the worker
+func (app *application) registerTasks(w *worker.Worker) {
+	w.Handle(taskMessageNotify, app.notifyMessageTask)
+	w.Handle(taskApplicationNotify, app.splitApplicationNotifyTask)
+	w.Handle(taskApplicationReceivedNotify, app.notifyApplicationReceivedTask)
+	w.Handle(taskNewApplicantNotify, app.notifyNewApplicantTask)
+	w.Handle(taskApplicationStatusNotify, app.notifyApplicationStatusTask)
+	w.Handle(taskAccountLockedNotify, app.notifyAccountLockedTask)
+	w.Handle(taskNewLoginNotify, app.notifyNewLoginTask)
+	w.Handle(taskJobAlertNotify, app.notifyJobAlertTask)
+
+	w.Every("offers.expire", time.Minute, app.expireOffers)
+	w.Every("jobs.alerts", time.Minute, app.sendJobAlerts)
+	w.Every("webhooks.deliver", 5*time.Second, app.deliverWebhooks)
+	w.Every("sessions.cleanup", time.Hour, app.Sessions.DeleteExpired)
+
+	// buckets in memory clean up after themselves
+	if store, ok := app.RateLimiter.(ratelimit.PostgresStore); ok {
+		w.Every("ratelimit.cleanup", 10*time.Minute, store.DeleteExpired)
+	}
+}
+
+// enqueueTask returns a transaction hook that queues a task.
+// The payload is marshalled when the hook runs, after the write it
+// belongs to has filled in ids and timestamps.
+func (app *application) enqueueTask(kind string, payload interface{}) data.TxFunc {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		return worker.Enqueue(ctx, tx, kind, payload)
+	}
+}
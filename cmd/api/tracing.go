@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/karnop/gojobs/internal/logging"
+	"github.com/karnop/gojobs/internal/tracing"
+)
+
+// newTracer sets up tracing from the standard OpenTelemetry environment variables:
+// OTEL_TRACES_EXPORTER is "otlp", "console" (spans as JSON on stdout) or "none", the default.
+// OTLP goes to OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT + /v1/traces,
+// with OTEL_EXPORTER_OTLP_HEADERS. It returns nil when tracing is off
+func newTracer(logger *slog.Logger) *tracing.Tracer {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "gojobs-api"
+	}
+
+	var exporter tracing.Exporter
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		if endpoint == "" {
+			base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+			if base == "" {
+				base = "http://localhost:4318"
+			}
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+		exporter = tracing.OTLPExporter{
+			URL:         endpoint,
+			Headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+			ServiceName: serviceName,
+		}
+		logger.Info("Exporting traces over OTLP", "endpoint", endpoint)
+
+	case "console":
+		exporter = tracing.StdoutExporter{W: os.Stdout}
+
+	default:
+		return nil
+	}
+
+	return tracing.NewTracer(exporter, logger)
+}
+
+// parseOTLPHeaders reads "key=value,key2=value2", values are URL encoded
+func parseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// traceRequests starts a server span for every request, continuing the trace in
+// the caller's traceparent header. Its context reaches the models through r.Context(),
+// so their queries show up as child spans, and the request's log lines get the trace id
+func (app *application) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, r.Method, tracing.KindServer)
+		if span == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer span.End()
+
+		sc := span.SpanContext()
+		ctx = logging.With(ctx, "trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String())
+		r = r.WithContext(ctx)
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// r.Pattern is set by the mux, see logRequests. It starts with the method
+		span.SetAttributes(
+			"http.request.method", r.Method,
+			"url.path", r.URL.Path,
+			"http.response.status_code", rec.status,
+			"request_id", r.Context().Value("requestId"),
+		)
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			_, route, _ := strings.Cut(r.Pattern, " ")
+			span.SetAttributes("http.route", route)
+		}
+		if info, ok := r.Context().Value("requestInfo").(*requestInfo); ok && info.userId != 0 {
+			span.SetAttributes("user.id", info.userId)
+		}
+		if rec.status >= 500 {
+			span.SetError(http.StatusText(rec.status))
+		}
+	})
+}
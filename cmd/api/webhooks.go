@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karnop/gojobs/internal/data"
+	"github.com/karnop/gojobs/internal/netguard"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// WEBHOOK HANDLERS
+
+// createWebhookHandler registers an endpoint for a recruiter's job and application events
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	// RBAC check
+	// events are about a recruiter's own jobs, so only recruiters can subscribe
+	user, err := app.Users.Get(r.Context(), userId)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if user.Role != "recruiter" {
+		app.errorResponse(w, r, http.StatusForbidden, "Only recruiters can register webhooks")
+		return
+	}
+
+	var input struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		UserId: userId,
+		URL:    input.URL,
+		Events: input.Events,
+	}
+
+	v := validator.New()
+	data.ValidateWebhook(v, webhook)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	err = app.Webhooks.Insert(r.Context(), webhook)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the secret is only ever shown here
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// listWebhooksHandler lists the user's webhooks
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	webhooks, err := app.Webhooks.GetAllForUser(r.Context(), userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": webhooks,
+	})
+}
+
+// deleteWebhookHandler removes one of the user's webhooks
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = app.Webhooks.Delete(r.Context(), id, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Webhook not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveriesHandler returns a page of a webhook's delivery log
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+	v := validator.New()
+
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	data.ValidateFilters(v, filters)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v)
+		return
+	}
+
+	deliveries, err := app.Webhooks.GetDeliveries(r.Context(), webhook.Id, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+// redeliverWebhookHandler queues an earlier delivery to be sent again
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.webhookForRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(r.PathValue("deliveryId"), 10, 64)
+	if err != nil || deliveryId < 1 {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := app.Webhooks.Redeliver(r.Context(), webhook.Id, deliveryId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Delivery not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// webhookForRequest loads the authenticated user's webhook from the {id} path value.
+// It writes the error response itself and returns ok=false when the handler should stop.
+func (app *application) webhookForRequest(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusBadRequest, "Invalid webhook ID")
+		return nil, false
+	}
+
+	userId, ok := r.Context().Value("userId").(int)
+	if !ok {
+		app.errorResponse(w, r, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	webhook, err := app.Webhooks.Get(r.Context(), id, userId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.errorResponse(w, r, http.StatusNotFound, "Webhook not found")
+		} else {
+			app.serverError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return webhook, true
+}
+
+// WEBHOOK DELIVERY
+
+// webhook retry policy: the delay doubles after each failed attempt
+const (
+	webhookMaxAttempts = 10
+	webhookBaseDelay   = 30 * time.Second
+	webhookMaxDelay    = 6 * time.Hour
+	webhookBatchSize   = 20
+)
+
+// a batch is sent concurrently, with a few requests per host at a time so a slow
+// endpoint doesn't hold up everyone else's. Even with a whole batch for one dead host
+// it's done well before ClaimDue's lease of a minute runs out
+const (
+	webhookTimeout         = 5 * time.Second
+	webhookConcurrency     = 10
+	webhookHostConcurrency = 4
+)
+
+// emitEvent returns a transaction hook that queues an event for the webhooks the owner
+// registered for it. The payload is marshalled when the hook runs, after the write
+// it belongs to has filled in ids and timestamps.
+func (app *application) emitEvent(ownerId int, event string, payload interface{}) data.TxFunc {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		body, err := json.Marshal(map[string]interface{}{
+			"event":       event,
+			"occurred_at": time.Now().UTC(),
+			"data":        payload,
+		})
+		if err != nil {
+			return err
+		}
+
+		return app.Webhooks.Enqueue(ctx, tx, ownerId, event, body)
+	}
+}
+
+// webhookClient sends webhook deliveries. Webhook URLs are chosen by users, so it
+// only connects to public addresses, checked after DNS resolution so a hostname
+// can't be pointed at the internal network once the webhook is registered
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		// no proxy, it would connect for us and skip the check
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: netguard.Control,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: webhookTimeout,
+		MaxIdleConnsPerHost: webhookHostConcurrency,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	// a redirect could point the signed payload somewhere else
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// deliverWebhooks sends a batch of the pending webhook deliveries that are due.
+// the worker calls it every few seconds
+func (app *application) deliverWebhooks(ctx context.Context) error {
+	deliveries, err := app.Webhooks.ClaimDue(ctx, webhookBatchSize)
+	if err != nil {
+		return err
+	}
+
+	slots := make(chan struct{}, webhookConcurrency)
+	hostSlots := make(map[string]chan struct{})
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		host := webhookHost(delivery.URL)
+		if hostSlots[host] == nil {
+			hostSlots[host] = make(chan struct{}, webhookHostConcurrency)
+		}
+		hostSlot := hostSlots[host]
+
+		wg.Go(func() {
+			hostSlot <- struct{}{}
+			defer func() { <-hostSlot }()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			app.attemptDelivery(ctx, webhookClient, delivery)
+		})
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// webhookHost is the host deliveries are grouped by, the URL itself if it doesn't parse
+func webhookHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// attemptDelivery sends one delivery and records the outcome
+func (app *application) attemptDelivery(ctx context.Context, client *http.Client, delivery *data.WebhookDelivery) {
+	statusCode, err := sendWebhook(ctx, client, delivery)
+	if err == nil {
+		err = app.Webhooks.MarkSucceeded(ctx, delivery.Id, statusCode)
+		if err != nil {
+			app.Logger.Error("Webhook delivery failed", "delivery_id", delivery.Id, "error", err)
+		}
+		return
+	}
+
+	// exponential backoff, no retry once the attempts run out
+	var retryIn time.Duration
+	attempt := delivery.Attempts + 1
+	if attempt < webhookMaxAttempts {
+		retryIn = min(webhookBaseDelay<<(attempt-1), webhookMaxDelay)
+	}
+
+	app.Logger.Warn("Webhook attempt failed",
+		"delivery_id", delivery.Id,
+		"webhook_id", delivery.WebhookId,
+		"attempt", attempt,
+		"status_code", statusCode,
+		"retry_in", retryIn.String(),
+		"error", err.Error(),
+	)
+
+	err = app.Webhooks.MarkAttemptFailed(ctx, delivery.Id, statusCode, err.Error(), retryIn)
+	if err != nil {
+		app.Logger.Error("Webhook delivery failed", "delivery_id", delivery.Id, "error", err)
+	}
+}
+
+// sendWebhook POSTs the signed payload. Any 2xx response counts as delivered.
+// statusCode is 0 when no response was received.
+//
+// Receivers verify a delivery by computing HMAC-SHA256 over "<timestamp>.<body>"
+// with their secret and comparing it to the X-GoJobs-Signature header. Rejecting
+// old timestamps protects them against replays.
+func sendWebhook(ctx context.Context, client *http.Client, delivery *data.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(delivery.Payload)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoJobs-Webhooks/1.0")
+	req.Header.Set("X-GoJobs-Event", delivery.Event)
+	req.Header.Set("X-GoJobs-Delivery", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-GoJobs-Timestamp", timestamp)
+	req.Header.Set("X-GoJobs-Signature", signature)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// draining a little of the body lets the connection be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint responded with %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/karnop/gojobs/internal/oidc"
+)
+
+// newTestServer starts the mock provider and an oidc.Provider configured against it
+func newTestServer(t *testing.T) *oidc.Provider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the issuer is the server URL, which is only known once it listens
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	srv.Config.Handler = newProvider(srv.URL, key, slog.New(slog.NewTextHandler(io.Discard, nil))).routes()
+
+	return oidc.NewProvider(oidc.Config{
+		Name:         "mock",
+		Issuer:       srv.URL,
+		ClientID:     "gojobs",
+		ClientSecret: "anything",
+		RedirectURL:  "https://api.gojobs.dev/auth/mock/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	})
+}
+
+// authorize signs in as email and returns the query the mock redirects back with
+func authorize(t *testing.T, p *oidc.Provider, email, state, nonce, verifier string) url.Values {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d", res.StatusCode)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), "https://api.gojobs.dev/auth/mock/callback?") {
+		t.Fatalf("redirected to %s", location)
+	}
+	return location.Query()
+}
+
+func TestLoginFlow(t *testing.T) {
+	p := newTestServer(t)
+	verifier := oidc.NewVerifier()
+
+	callback := authorize(t, p, "zoe@example.com", "the-state", "the-nonce", verifier)
+	if callback.Get("state") != "the-state" {
+		t.Errorf("state = %q, want it echoed back", callback.Get("state"))
+	}
+
+	claims, err := p.Exchange(context.Background(), callback.Get("code"), verifier, "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email, ok := claims.VerifiedEmail(); !ok || email != "zoe@example.com" {
+		t.Errorf("VerifiedEmail() = %q, %v", email, ok)
+	}
+	if claims.Subject == "" || claims.Name != "zoe" {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// a code works once
+	_, err = p.Exchange(context.Background(), callback.Get("code"), verifier, "the-nonce")
+	if err == nil {
+		t.Error("a used code was exchanged again")
+	}
+}
+
+func TestLoginFlowRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier func(verifier string) string
+		nonce    string
+	}{
+		{"wrong PKCE verifier", func(string) string { return oidc.NewVerifier() }, "the-nonce"},
+		{"no PKCE verifier", func(string) string { return "" }, "the-nonce"},
+		{"nonce mismatch", func(v string) string { return v }, "another-nonce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestServer(t)
+			verifier := oidc.NewVerifier()
+
+			callback := authorize(t, p, "zoe@example.com", "the-state", "the-nonce", verifier)
+
+			_, err := p.Exchange(context.Background(), callback.Get("code"), tt.verifier(verifier), tt.nonce)
+			if err == nil {
+				t.Fatal("Exchange succeeded")
+			}
+		})
+	}
+}
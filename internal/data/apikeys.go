@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// API key scopes
+const (
+	ScopeJobsRead          = "jobs:read"
+	ScopeJobsWrite         = "jobs:write"
+	ScopeApplicationsRead  = "applications:read"
+	ScopeApplicationsWrite = "applications:write"
+	ScopeWebhooksRead      = "webhooks:read"
+	ScopeWebhooksWrite     = "webhooks:write"
+)
+
+// APIKeyScopes lists every scope a key can be given
+var APIKeyScopes = []string{
+	ScopeJobsRead, ScopeJobsWrite,
+	ScopeApplicationsRead, ScopeApplicationsWrite,
+	ScopeWebhooksRead, ScopeWebhooksWrite,
+}
+
+// apiKeyMaxLifetime is the furthest in the future a key can expire
+const apiKeyMaxLifetime = 366 * 24 * time.Hour
+
+// APIKey lets scripts act as the user who created it, within its scopes.
+// keys look like "gjk_<prefix>_<secret>"
+type APIKey struct {
+	Id         int        `json:"id"`
+	UserId     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"` // only returned when the key is created
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	hash []byte
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// ValidateAPIKey checks a key before it is created
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.CheckCode(key.Name != "", "name", validator.CodeRequired)
+	v.CheckCode(utf8.RuneCountInString(key.Name) <= 100, "name", validator.CodeTooLong, 100)
+
+	v.CheckCode(len(key.Scopes) > 0, "scopes", validator.CodeTooFew, 1)
+	for _, scope := range key.Scopes {
+		v.CheckCode(validator.PermittedValue(scope, APIKeyScopes...), "scopes", validator.CodeUnknown, scope)
+	}
+
+	latest := time.Now().Add(apiKeyMaxLifetime)
+	v.CheckCode(key.ExpiresAt.After(time.Now()), "expires_at", validator.CodeFuture)
+	v.CheckCode(key.ExpiresAt.Before(latest), "expires_at", validator.CodeLessThanOrEqual, latest.UTC().Format(time.RFC3339))
+}
+
+// Insert generates the key and stores its hash, the plain key is left in key.Key
+func (m APIKeyModel) Insert(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	key.Prefix = strings.ToLower(rand.Text()[:8])
+	key.Key = "gjk_" + key.Prefix + "_" + rand.Text()
+	key.hash = hashAPIKey(key.Key)
+
+	args := []interface{}{key.UserId, key.Name, key.Prefix, key.hash, key.Scopes, key.ExpiresAt}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.Id, &key.CreatedAt)
+}
+
+// GetAllForUser lists the user's keys, newest first
+func (m APIKeyModel) GetAllForUser(ctx context.Context, userId int) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Delete revokes one of the user's keys
+func (m APIKeyModel) Delete(ctx context.Context, id int, userId int) error {
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Authenticate returns the unexpired key matching plaintext,
+// ErrRecordNotFound covers malformed, unknown, wrong and expired keys alike
+func (m APIKeyModel) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	parts := strings.Split(plaintext, "_")
+	if len(parts) != 3 || parts[0] != "gjk" {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE prefix = $1 AND expires_at > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(m.DB.QueryRowContext(ctx, query, parts[1]))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(key.hash, hashAPIKey(plaintext)) != 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	return key, nil
+}
+
+// MarkUsed records that the key was just used
+func (m APIKeyModel) MarkUsed(ctx context.Context, id int) error {
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// HasScope reports whether the key was given scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// scanAPIKey reads an api_keys row from a *sql.Row or *sql.Rows
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(
+		&key.Id,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		&key.hash,
+		pgtype.NewMap().SQLScanner(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// hashAPIKey hashes a key for storage, keys are long and random so a fast hash is safe
+func hashAPIKey(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
@@ -0,0 +1,52 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+func TestValidateAPIKeyCodes(t *testing.T) {
+	valid := func() *APIKey {
+		return &APIKey{Name: "ci", Scopes: []string{ScopeJobsRead}, ExpiresAt: time.Now().Add(24 * time.Hour)}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*APIKey)
+		key    string
+		code   string
+		params []interface{}
+	}{
+		{"no scopes", func(k *APIKey) { k.Scopes = nil }, "scopes", validator.CodeTooFew, []interface{}{1}},
+		{"unknown scope", func(k *APIKey) { k.Scopes = []string{ScopeJobsRead, "jobs:delete"} }, "scopes", validator.CodeUnknown, []interface{}{"jobs:delete"}},
+		{"expired", func(k *APIKey) { k.ExpiresAt = time.Now().Add(-time.Hour) }, "expires_at", validator.CodeFuture, nil},
+		{"more than a year away", func(k *APIKey) { k.ExpiresAt = time.Now().Add(2 * apiKeyMaxLifetime) }, "expires_at", validator.CodeLessThanOrEqual, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := valid()
+			tt.change(key)
+
+			v := validator.New()
+			ValidateAPIKey(v, key)
+
+			errs := v.FieldErrors[tt.key]
+			if len(errs) != 1 || errs[0].Code != tt.code {
+				t.Fatalf("%s errors = %+v, want one %q", tt.key, errs, tt.code)
+			}
+			if tt.params != nil && fmt.Sprint(errs[0].Params) != fmt.Sprint(tt.params) {
+				t.Errorf("%s params = %v, want %v", tt.key, errs[0].Params, tt.params)
+			}
+		})
+	}
+
+	v := validator.New()
+	ValidateAPIKey(v, valid())
+	if !v.Valid() {
+		t.Errorf("valid key has errors: %v", v.Errors)
+	}
+}
@@ -12,6 +12,19 @@ import (
 // ErrDuplicateApplication is returned when a user applies twice
 var ErrDuplicateApplication = errors.New("you have already applied to this job")
 
+// ErrStatusChange is returned when an application isn't in a status it can change from
+var ErrStatusChange = errors.New("application can't change to this status from its current one")
+
+// application statuses
+const (
+	StatusApplied      = "applied"
+	StatusInterviewing = "interviewing"
+	StatusOffered      = "offered"
+	StatusHired        = "hired"
+	StatusDeclined     = "declined"
+	StatusRejected     = "rejected"
+)
+
 type JobApplication struct {
 	Id int `json:"id"`
 	JobId int `json:"job_id"`
@@ -25,21 +38,24 @@ type JobApplicationModel struct {
 }
 
 // Insert creates a new application record
-func(m JobApplicationModel) Insert(application *JobApplication) error {
+// the hooks run in the same transaction once the application has its id
+func(m JobApplicationModel) Insert(ctx context.Context, application *JobApplication, hooks ...TxFunc) error {
 	query := `
 		INSERT INTO applications (job_id, user_id, status)
 		VALUES ($1, $2, 'applied')
 		RETURNING id, created_at, status
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, application.JobId, application.UserId).Scan(
-		&application.Id,
-		&application.CreatedAt,
-		&application.Status,
-	)
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, application.JobId, application.UserId).Scan(
+			&application.Id,
+			&application.CreatedAt,
+			&application.Status,
+		)
+	}, hooks)
 
 	if err != nil {
 		var pgErr *pgconn.PgError
@@ -53,4 +69,69 @@ func(m JobApplicationModel) Insert(application *JobApplication) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// UpdateStatus moves an application to status, only from one of the from statuses.
+// That's checked as it's updated so a concurrent offer can't slip in between.
+// the hooks run in the same transaction once the application has its new status
+func (m JobApplicationModel) UpdateStatus(ctx context.Context, application *JobApplication, status string, from []string, hooks ...TxFunc) error {
+	query := `
+		UPDATE applications
+		SET status = $1
+		WHERE id = $2 AND status = ANY($3)
+		RETURNING status`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, status, application.Id, from).Scan(&application.Status)
+	}, hooks)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrStatusChange
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get fetches a single application by its id
+func (m JobApplicationModel) Get(ctx context.Context, id int) (*JobApplication, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return getApplication(ctx, m.DB.QueryRowContext, id)
+}
+
+// GetTx fetches an application inside tx, seeing what tx changed before it commits
+func (m JobApplicationModel) GetTx(ctx context.Context, tx *sql.Tx, id int) (*JobApplication, error) {
+	return getApplication(ctx, tx.QueryRowContext, id)
+}
+
+func getApplication(ctx context.Context, queryRow func(ctx context.Context, query string, args ...interface{}) *sql.Row, id int) (*JobApplication, error) {
+	query := `
+		SELECT id, job_id, user_id, status, created_at
+		FROM applications
+		WHERE id = $1`
+
+	var application JobApplication
+	err := queryRow(ctx, query, id).Scan(
+		&application.Id,
+		&application.JobId,
+		&application.UserId,
+		&application.Status,
+		&application.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &application, nil
+}
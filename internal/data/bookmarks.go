@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// BookmarkModel stores the jobs users saved for later
+type BookmarkModel struct {
+	DB *sql.DB
+}
+
+// Insert bookmarks a job for a user, bookmarking twice is not an error
+func (m BookmarkModel) Insert(ctx context.Context, userId int, jobId int) error {
+	query := `
+		INSERT INTO bookmarks (user_id, job_id)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id, job_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userId, jobId)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			// Code "23503" is foreign_key_violation, the job doesn't exist
+			if pgErr.Code == "23503" {
+				return ErrRecordNotFound
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes a bookmark
+func (m BookmarkModel) Delete(ctx context.Context, userId int, jobId int) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND job_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, jobId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetJobsForUser returns a page of the user's bookmarked jobs, most recently bookmarked first.
+// closed jobs stay in the list with their closed_at set, so the user sees they closed
+func (m BookmarkModel) GetJobsForUser(ctx context.Context, userId int, filters Filters) ([]*Job, error) {
+	query := `
+		SELECT j.id, j.title, j.company, j.description, j.salary, j.user_id, j.created_at, j.closed_at
+		FROM bookmarks b
+		JOIN jobs j ON j.id = b.job_id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC, j.id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookmarked := true
+
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&job.Id,
+			&job.Title,
+			&job.Company,
+			&job.Description,
+			&job.Salary,
+			&job.UserId,
+			&job.CreatedAt,
+			&job.ClosedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		job.IsBookmarked = &bookmarked
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// MarkBookmarked sets IsBookmarked on each job for the given user
+func (m BookmarkModel) MarkBookmarked(ctx context.Context, userId int, jobs []*Job) error {
+	ids := make([]int, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.Id
+	}
+
+	query := `
+		SELECT job_id
+		FROM bookmarks
+		WHERE user_id = $1 AND job_id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bookmarked := make(map[int]bool)
+	for rows.Next() {
+		var jobId int
+		if err := rows.Scan(&jobId); err != nil {
+			return err
+		}
+		bookmarked[jobId] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		isBookmarked := bookmarked[job.Id]
+		job.IsBookmarked = &isBookmarked
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// CompanyModel stores which recruiters an admin confirmed work for a company.
+// Company policies, like requiring two-factor authentication, apply to those recruiters.
+// The company on a job is free text and proves nothing, so it isn't used for this
+type CompanyModel struct {
+	DB *sql.DB
+}
+
+// AddRecruiter records that a user recruits for company, adding them again is not an error
+func (m CompanyModel) AddRecruiter(ctx context.Context, company string, userId int, addedBy int) error {
+	query := `
+		INSERT INTO company_recruiters (company, user_id, added_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (company, user_id) DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, company, userId, addedBy)
+	return err
+}
+
+// RemoveRecruiter removes a user from company, ErrRecordNotFound if they weren't in it
+func (m CompanyModel) RemoveRecruiter(ctx context.Context, company string, userId int) error {
+	query := `DELETE FROM company_recruiters WHERE company = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, company, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
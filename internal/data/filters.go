@@ -2,6 +2,8 @@ package data
 
 import (
 	"strings"
+
+	"github.com/karnop/gojobs/internal/validator"
 )
 
 type Filters struct {
@@ -41,4 +43,17 @@ func (f Filters) sortDirection() string {
 		return "DESC"
 	}
 	return "ASC"
-}
\ No newline at end of file
+}
+
+// ValidateFilters checks the page and page size are in a sane range
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.CheckCode(f.Page > 0, "page", validator.CodeGreaterThan, 0)
+	v.CheckCode(f.Page <= 10_000_000, "page", validator.CodeLessThanOrEqual, 10_000_000)
+	v.CheckCode(f.PageSize > 0, "page_size", validator.CodeGreaterThan, 0)
+	v.CheckCode(f.PageSize <= 100, "page_size", validator.CodeLessThanOrEqual, 100)
+
+	// only listings that sort have a safelist
+	if len(f.SortSafelist) > 0 {
+		v.CheckCode(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", validator.CodeOneOf, strings.Join(f.SortSafelist, ", "))
+	}
+}
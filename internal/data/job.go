@@ -6,18 +6,22 @@ import (
 	"fmt"
 	"context"
 	"database/sql"
+	"errors"
 )
 
 // job represents a job posting in the application
 type Job struct {
 	// omitempty means if id is empty, hide it in JSON
 	Id          int `json:"id,omitempty"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Company     string `json:"company"`
-	Salary      int    `json:"salary"`
+	Title       string `json:"title" validate:"required,max=100"`
+	Description string `json:"description" validate:"required"`
+	Company     string `json:"company" validate:"required"`
+	Salary      int    `json:"salary" validate:"gte=0"`
 	UserId      int    `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+	// only set when the request is authenticated
+	IsBookmarked *bool `json:"is_bookmarked,omitempty"`
 }
 
 type JobModel struct {
@@ -25,42 +29,41 @@ type JobModel struct {
 }
 
 // ValidateJob checks if the Job struct is safe to insert
+// the rules are in the validate tags on Job
 func ValidateJob(v *validator.Validator, job *Job) {
-	// title must not be empty and less than 100 chars
-	v.Check(job.Title != "", "title", "must be provided")
-	v.Check(len(job.Title) <= 100, "title", "must not be more than 100 characters")
-
-	// Description is required
-	v.Check(job.Description != "", "description", "must be provided")
-
-	// Company is required
-	v.Check(job.Company != "", "company", "must be provided")
-
-	// Salary is required
-	v.Check(job.Salary >= 0, "salary", "must be a positive number")
+	v.Struct(job)
 }
 
 
 // Insert adds a new job to the database
-func (m JobModel) Insert(job *Job) error {
+// the hooks run in the same transaction once the job has its id
+func (m JobModel) Insert(ctx context.Context, job *Job, hooks ...TxFunc) error {
 	query := `
 		INSERT INTO jobs (title, description, company, salary, user_id, created_at)
 		VALUES ($1, $2, $3, $4, $5, NOW())
 		RETURNING id, created_at`
 
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
 	// Use QueryRow because we want to get the ID back
-	return m.DB.QueryRow(query, job.Title, job.Description, job.Company, job.Salary, job.UserId).Scan(&job.Id, &job.CreatedAt)
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, job.Title, job.Description, job.Company, job.Salary, job.UserId).Scan(&job.Id, &job.CreatedAt)
+	}, hooks)
 }
 
 // Get fetches a single job by ID
-func (m JobModel) Get(id int) (*Job, error) {
+func (m JobModel) Get(ctx context.Context, id int) (*Job, error) {
 	query := `
-		SELECT id, title, description, company, salary, user_id, created_at
+		SELECT id, title, description, company, salary, user_id, created_at, closed_at
 		FROM jobs
 		WHERE id = $1`
 
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
 	var job Job
-	err := m.DB.QueryRow(query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&job.Id,
 		&job.Title,
 		&job.Description,
@@ -68,6 +71,7 @@ func (m JobModel) Get(id int) (*Job, error) {
 		&job.Salary,
 		&job.UserId,
 		&job.CreatedAt,
+		&job.ClosedAt,
 	)
 
 	if err != nil {
@@ -77,13 +81,71 @@ func (m JobModel) Get(id int) (*Job, error) {
 	return &job, nil
 }
 
+// Close stops a job taking applications, only the recruiter who posted it can close it.
+// It returns ErrRecordNotFound if the job doesn't exist, isn't theirs or is already closed.
+func (m JobModel) Close(ctx context.Context, job *Job, hooks ...TxFunc) error {
+	query := `
+		UPDATE jobs
+		SET closed_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND closed_at IS NULL
+		RETURNING closed_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, job.Id, job.UserId).Scan(&job.ClosedAt)
+	}, hooks)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
 // GetAll fetches a list of jobs based on filters
-func (m JobModel) GetAll(title string, company string, filters Filters) ([]*Job, error) {
+func (m JobModel) GetAll(ctx context.Context, title string, company string, filters Filters) ([]*Job, error) {
+	return m.search(ctx, title, company, 0, 0, filters)
+}
+
+// GetNewMatches fetches jobs matching the filters that were posted after afterId,
+// up to and including uptoId. Job ids only grow, so they work as a cursor for alerts.
+func (m JobModel) GetNewMatches(ctx context.Context, title string, company string, afterId int, uptoId int, filters Filters) ([]*Job, error) {
+	return m.search(ctx, title, company, afterId, uptoId, filters)
+}
+
+// MaxSettledId returns the id of the most recent job posted at least settle ago, or 0.
+// Ids are handed out before the insert commits, so a job can show up after one with a
+// higher id. Once settle is longer than posting a job takes, every job up to the
+// returned id is committed, and a cursor moved to it never skips one
+func (m JobModel) MaxSettledId(ctx context.Context, settle time.Duration) (int, error) {
+	query := `
+		SELECT COALESCE(MAX(id), 0)
+		FROM jobs
+		WHERE created_at <= NOW() - $1 * INTERVAL '1 second'`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, query, settle.Seconds()).Scan(&id)
+	return id, err
+}
+
+// search runs the job listing query, an uptoId of 0 means no upper bound
+func (m JobModel) search(ctx context.Context, title string, company string, afterId int, uptoId int, filters Filters) ([]*Job, error) {
 	query := fmt.Sprintf(`
 		SELECT id, title, company, description, salary, user_id, created_at
 		FROM jobs
 		WHERE (LOWER(title) LIKE LOWER($1) OR $1 = '')
 		AND (LOWER(company) LIKE LOWER($2) OR $2 = '')
+		AND closed_at IS NULL
+		AND id > $5
+		AND (id <= $6 OR $6 = 0)
 		ORDER BY %s %s, id ASC
 		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 
@@ -93,9 +155,11 @@ func (m JobModel) GetAll(title string, company string, filters Filters) ([]*Job,
 		"%" + company + "%",   // $2: search company (partial match)
 		filters.limit(),       // $3: limit
 		filters.offset(),      // $4: offset
+		afterId,               // $5: only jobs after this id
+		uptoId,                // $6: only jobs up to this id
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// executing Query
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LoginThrottleModel counts failed logins per key (an email address or a client IP)
+// and blocks further attempts for a while once there are too many.
+// Keys are counted whether or not an account exists, so a throttled unknown
+// email looks exactly like a throttled real one.
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// BlockedFor returns how long the most restricted of keys is still blocked, zero if none are
+func (m LoginThrottleModel) BlockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	query := `
+		SELECT COALESCE(MAX(EXTRACT(EPOCH FROM blocked_until - NOW())), 0)::float8
+		FROM login_throttles
+		WHERE key = ANY($1) AND blocked_until > NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var seconds float64
+	err := m.DB.QueryRowContext(ctx, query, keys).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecordFailure counts a failed login against key and returns the failures so far.
+// failures older than window are forgotten first
+func (m LoginThrottleModel) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_throttles AS t (key, failures, last_failed_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE WHEN t.last_failed_at < NOW() - make_interval(secs => $2::float8) THEN 1 ELSE t.failures + 1 END,
+			last_failed_at = NOW()
+		RETURNING failures`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, query, key, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+// Block stops logins for key for the given duration
+func (m LoginThrottleModel) Block(ctx context.Context, key string, d time.Duration) error {
+	query := `
+		UPDATE login_throttles
+		SET blocked_until = NOW() + make_interval(secs => $2::float8)
+		WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key, d.Seconds())
+	return err
+}
+
+// Reset forgets the failures for key and lifts any block,
+// it's used after a successful login and when an admin unlocks an account
+func (m LoginThrottleModel) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_throttles WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key)
+	return err
+}
+
+// LoginDeviceModel remembers the IP and user agent combinations each user has logged in from
+type LoginDeviceModel struct {
+	DB *sql.DB
+}
+
+// Seen records a successful login and reports whether it came from a device the
+// user hasn't used before. The very first login isn't reported as new,
+// there is nothing to compare it with.
+func (m LoginDeviceModel) Seen(ctx context.Context, userId int, ip string, userAgent string) (bool, error) {
+	// the subquery runs against the snapshot from before the insert
+	query := `
+		INSERT INTO login_devices (user_id, ip, user_agent)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, ip, user_agent) DO UPDATE
+		SET last_seen_at = NOW()
+		RETURNING xmax = 0, (SELECT COUNT(*) FROM login_devices WHERE user_id = $1)`
+
+	userAgent = cleanUserAgent(userAgent)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var inserted bool
+	var known int
+	err := m.DB.QueryRowContext(ctx, query, userId, ip, userAgent).Scan(&inserted, &known)
+	if err != nil {
+		return false, err
+	}
+
+	return inserted && known > 0, nil
+}
@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// Message is a single message in the thread attached to an application
+type Message struct {
+	Id            int        `json:"id"`
+	ApplicationId int        `json:"application_id"`
+	SenderId      int        `json:"sender_id"`
+	Body          string     `json:"body" validate:"required,max=5000"`
+	ReadAt        *time.Time `json:"read_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Thread summarises the conversation on one application for a participant
+type Thread struct {
+	ApplicationId int       `json:"application_id"`
+	JobId         int       `json:"job_id"`
+	JobTitle      string    `json:"job_title"`
+	Unread        int       `json:"unread"`
+	LastMessageAt time.Time `json:"last_message_at"`
+}
+
+type MessageModel struct {
+	DB *sql.DB
+}
+
+// ValidateMessage checks a message before it is stored
+func ValidateMessage(v *validator.Validator, message *Message) {
+	v.Struct(message)
+}
+
+// Insert adds a message to an application's thread
+// the hooks run in the same transaction once the message has its id
+func (m MessageModel) Insert(ctx context.Context, message *Message, hooks ...TxFunc) error {
+	query := `
+		INSERT INTO messages (application_id, sender_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, message.ApplicationId, message.SenderId, message.Body).Scan(&message.Id, &message.CreatedAt)
+	}, hooks)
+}
+
+// GetAllForApplication returns a page of an application's thread, oldest first
+func (m MessageModel) GetAllForApplication(ctx context.Context, applicationId int, filters Filters) ([]*Message, error) {
+	query := `
+		SELECT id, application_id, sender_id, body, read_at, created_at
+		FROM messages
+		WHERE application_id = $1
+		ORDER BY id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, applicationId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		var message Message
+		err := rows.Scan(
+			&message.Id,
+			&message.ApplicationId,
+			&message.SenderId,
+			&message.Body,
+			&message.ReadAt,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// MarkRead sets the read receipt on the messages in the thread that were sent to the
+// reader, up to and including upToId. Later messages stay unread, the reader hasn't seen them
+func (m MessageModel) MarkRead(ctx context.Context, applicationId int, readerId int, upToId int) error {
+	query := `
+		UPDATE messages
+		SET read_at = NOW()
+		WHERE application_id = $1 AND sender_id <> $2 AND id <= $3 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, applicationId, readerId, upToId)
+	return err
+}
+
+// GetThreadsForUser lists every thread the user takes part in, either as the
+// applicant or as the recruiter who owns the job, with their unread counts
+func (m MessageModel) GetThreadsForUser(ctx context.Context, userId int) ([]*Thread, error) {
+	query := `
+		SELECT a.id, j.id, j.title,
+			COUNT(*) FILTER (WHERE m.sender_id <> $1 AND m.read_at IS NULL),
+			MAX(m.created_at)
+		FROM messages m
+		JOIN applications a ON a.id = m.application_id
+		JOIN jobs j ON j.id = a.job_id
+		WHERE a.user_id = $1 OR j.user_id = $1
+		GROUP BY a.id, j.id, j.title
+		ORDER BY MAX(m.created_at) DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*Thread{}
+	for rows.Next() {
+		var thread Thread
+		err := rows.Scan(
+			&thread.ApplicationId,
+			&thread.JobId,
+			&thread.JobTitle,
+			&thread.Unread,
+			&thread.LastMessageAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, &thread)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
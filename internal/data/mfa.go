@@ -0,0 +1,258 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMFAEnabled    = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled = errors.New("two-factor authentication not enabled")
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time
+const recoveryCodeCount = 10
+
+// TOTP is a user's authenticator secret
+type TOTP struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64 // zero until a code has been accepted
+}
+
+// MFAModel stores two-factor authentication secrets, recovery codes and company policies
+type MFAModel struct {
+	DB *sql.DB
+}
+
+// GetTOTP returns the user's secret, ErrMFANotEnabled if they never started enrolling
+func (m MFAModel) GetTOTP(ctx context.Context, userId int) (*TOTP, error) {
+	query := `
+		SELECT totp_secret, mfa_enabled, COALESCE(totp_last_step, 0)
+		FROM users
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var secret sql.NullString
+	var totp TOTP
+
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(&secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if !secret.Valid {
+		return nil, ErrMFANotEnabled
+	}
+	totp.Secret = secret.String
+
+	return &totp, nil
+}
+
+// SetPendingSecret stores a new secret that becomes active once Enable confirms it.
+// starting over replaces an earlier pending secret, but not an enabled one
+func (m MFAModel) SetPendingSecret(ctx context.Context, userId int, secret string) error {
+	query := `
+		UPDATE users
+		SET totp_secret = $2, totp_last_step = NULL
+		WHERE id = $1 AND NOT mfa_enabled`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrMFAEnabled
+	}
+
+	return nil
+}
+
+// UseStep records that the code for step was used. It returns false if that step,
+// or a later one, was already used so the same code can't be replayed.
+func (m MFAModel) UseStep(ctx context.Context, userId int, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = $2
+		WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// Enable turns on two-factor authentication with the pending secret
+// and replaces any recovery codes with the hashes given
+func (m MFAModel) Enable(ctx context.Context, userId int, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE users SET mfa_enabled = TRUE WHERE id = $1`, userId)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, recoveryCodeHashes)
+	}, nil)
+}
+
+// Disable turns off two-factor authentication and forgets the secret and recovery codes
+func (m MFAModel) Disable(ctx context.Context, userId int) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users
+			SET totp_secret = NULL, mfa_enabled = FALSE, totp_last_step = NULL
+			WHERE id = $1`
+
+		_, err := tx.ExecContext(ctx, query, userId)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userId, nil)
+	}, nil)
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for new ones
+func (m MFAModel) ReplaceRecoveryCodes(ctx context.Context, userId int, hashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userId, hashes)
+	}, nil)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId int, hashes [][]byte) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks the matching unused recovery code as used,
+// it returns false when there is no such code
+func (m MFAModel) UseRecoveryCode(ctx context.Context, userId int, code string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userId, HashRecoveryCode(code))
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// Required reports whether the user is a recruiter for a company that requires two-factor
+// authentication. Only companies an admin added them to count, see CompanyModel
+func (m MFAModel) Required(ctx context.Context, userId int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM company_mfa_policies p
+			JOIN company_recruiters c ON c.company = p.company
+			JOIN users u ON u.id = c.user_id
+			WHERE c.user_id = $1 AND u.role = 'recruiter' AND p.require_mfa
+		)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var required bool
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(&required)
+	return required, err
+}
+
+// SetCompanyPolicy sets whether a company's recruiters must use two-factor authentication
+func (m MFAModel) SetCompanyPolicy(ctx context.Context, company string, required bool) error {
+	query := `
+		INSERT INTO company_mfa_policies (company, require_mfa)
+		VALUES ($1, $2)
+		ON CONFLICT (company) DO UPDATE
+		SET require_mfa = EXCLUDED.require_mfa, updated_at = NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, company, required)
+	return err
+}
+
+// NewRecoveryCodes generates a set of recovery codes, formatted like "abcde-fghij",
+// along with the hashes to store. The plain codes are only shown to the user once.
+func NewRecoveryCodes() ([]string, [][]byte) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+
+	for i := range codes {
+		text := strings.ToLower(rand.Text())
+		codes[i] = text[:5] + "-" + text[5:10]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes
+}
+
+// HashRecoveryCode hashes a recovery code for storage. The codes are random enough
+// that a fast hash is safe, and case, spaces and dashes are ignored so typos in
+// formatting don't matter.
+func HashRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lastStepDB is a database/sql driver standing in for the users table's
+// totp_last_step column. It applies UseStep's WHERE clause to the arguments
+// so the model's handling of the result can be tested without Postgres
+type lastStepDB struct {
+	mu   sync.Mutex
+	last map[int64]int64
+}
+
+func (d *lastStepDB) Connect(context.Context) (driver.Conn, error) { return lastStepConn{d}, nil }
+func (d *lastStepDB) Driver() driver.Driver                        { return nil }
+
+type lastStepConn struct{ db *lastStepDB }
+
+func (c lastStepConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c lastStepConn) Close() error                        { return nil }
+func (c lastStepConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c lastStepConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.Contains(query, "totp_last_step IS NULL OR totp_last_step < $2") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	userId, step := args[0].Value.(int64), args[1].Value.(int64)
+
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	last, ok := c.db.last[userId]
+	if ok && last >= step {
+		return driver.RowsAffected(0), nil
+	}
+	c.db.last[userId] = step
+	return driver.RowsAffected(1), nil
+}
+
+func TestUseStepRejectsReplay(t *testing.T) {
+	db := sql.OpenDB(&lastStepDB{last: map[int64]int64{}})
+	t.Cleanup(func() { db.Close() })
+
+	m := MFAModel{DB: db}
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		userId int
+		step   int64
+		want   bool
+	}{
+		{"first use", 1, 100, true},
+		{"same step again", 1, 100, false},
+		{"earlier step, still inside the skew", 1, 99, false},
+		{"next step", 1, 101, true},
+		{"replay of the next step", 1, 101, false},
+		{"another user, same step", 2, 101, true},
+	}
+
+	// in order, each use depends on the ones before it
+	for _, s := range steps {
+		got, err := m.UseStep(ctx, s.userId, s.step)
+		if err != nil {
+			t.Fatalf("%s: UseStep() error: %v", s.name, err)
+		}
+		if got != s.want {
+			t.Errorf("%s: UseStep(%d, %d) = %v, want %v", s.name, s.userId, s.step, got, s.want)
+		}
+	}
+}
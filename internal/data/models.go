@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/karnop/gojobs/internal/logging"
+)
+
+// shared errors returned by the models
+var (
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+// TxFunc runs extra statements inside a model's transaction.
+// handlers use it to queue background tasks and webhook deliveries
+// that must only exist if the write they belong to commits.
+type TxFunc func(ctx context.Context, tx *sql.Tx) error
+
+// withTx runs fn and then each of the hooks in a single transaction
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error, hooks []TxFunc) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			logging.FromContext(ctx).Error("Cannot roll back transaction", "error", err)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		err = hook(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// maxUserAgentBytes bounds the user agents stored with sessions and login devices
+const maxUserAgentBytes = 255
+
+// cleanUserAgent makes a client controlled User-Agent safe to store: net/http passes
+// header bytes through as they are and Postgres refuses invalid UTF-8 in text columns,
+// so invalid sequences are replaced, and long values are cut on a character boundary
+func cleanUserAgent(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= maxUserAgentBytes {
+		return s
+	}
+
+	end := 0
+	for i, r := range s {
+		if i+utf8.RuneLen(r) > maxUserAgentBytes {
+			break
+		}
+		end = i + utf8.RuneLen(r)
+	}
+	return s[:end]
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanUserAgent(t *testing.T) {
+	// 300 bytes of two and three byte characters, byte 255 is inside a character
+	long := strings.Repeat("ü", 61) + strings.Repeat("日", 59) + "a"
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"short", "Mozilla/5.0 (X11; Linux x86_64)", "Mozilla/5.0 (X11; Linux x86_64)"},
+		{"empty", "", ""},
+		{"non-ASCII cut on a character", long, strings.Repeat("ü", 61) + strings.Repeat("日", 44)},
+		{"invalid bytes replaced", "curl/8.0 \xff\xfe", "curl/8.0 �"},
+		{"invalid bytes in a long value", strings.Repeat("a\xff", 150), strings.Repeat("a�", 63) + "a"},
+		{"exactly the limit", strings.Repeat("a", 255), strings.Repeat("a", 255)},
+		{"ASCII over the limit", strings.Repeat("a", 300), strings.Repeat("a", 255)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cleanUserAgent(tt.in)
+			if got != tt.want {
+				t.Errorf("cleanUserAgent() = %q (%d bytes), want %q (%d bytes)", got, len(got), tt.want, len(tt.want))
+			}
+			if !utf8.ValidString(got) || len(got) > maxUserAgentBytes {
+				t.Errorf("cleanUserAgent() = %q, %d bytes, valid UTF-8 %v", got, len(got), utf8.ValidString(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// NotificationPreferences says which emails a user wants
+type NotificationPreferences struct {
+	UserId              int  `json:"-"`
+	ApplicationReceived bool `json:"application_received"` // candidate: confirmation after applying
+	ApplicationStatus   bool `json:"application_status"`   // candidate: their application changed status
+	NewApplicant        bool `json:"new_applicant"`        // recruiter: someone applied to their job
+	NewMessage          bool `json:"new_message"`          // both: a message arrived on an application
+}
+
+type NotificationPreferenceModel struct {
+	DB *sql.DB
+}
+
+// Get returns the user's preferences, everything is on until the user changes it
+func (m NotificationPreferenceModel) Get(ctx context.Context, userId int) (*NotificationPreferences, error) {
+	query := `
+		SELECT application_received, application_status, new_applicant, new_message
+		FROM notification_preferences
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	prefs := NotificationPreferences{
+		UserId:              userId,
+		ApplicationReceived: true,
+		ApplicationStatus:   true,
+		NewApplicant:        true,
+		NewMessage:          true,
+	}
+
+	err := m.DB.QueryRowContext(ctx, query, userId).Scan(
+		&prefs.ApplicationReceived,
+		&prefs.ApplicationStatus,
+		&prefs.NewApplicant,
+		&prefs.NewMessage,
+	)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return &prefs, nil
+}
+
+// Upsert stores the user's preferences
+func (m NotificationPreferenceModel) Upsert(ctx context.Context, prefs *NotificationPreferences) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, application_received, application_status, new_applicant, new_message)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET application_received = EXCLUDED.application_received,
+			application_status = EXCLUDED.application_status,
+			new_applicant = EXCLUDED.new_applicant,
+			new_message = EXCLUDED.new_message`
+
+	args := []interface{}{prefs.UserId, prefs.ApplicationReceived, prefs.ApplicationStatus, prefs.NewApplicant, prefs.NewMessage}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
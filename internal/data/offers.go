@@ -0,0 +1,338 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// offer errors
+var (
+	ErrOpenOfferExists = errors.New("an open offer already exists for this application")
+	ErrOfferNotOpen    = errors.New("offer is not open for this action")
+	// ErrApplicationNotOpen is returned when the application moved on, e.g. was
+	// rejected, after the offer was drafted
+	ErrApplicationNotOpen = errors.New("application is not open for this offer")
+)
+
+// offer statuses
+const (
+	OfferDraft    = "draft"
+	OfferSent     = "sent"
+	OfferAccepted = "accepted"
+	OfferDeclined = "declined"
+	OfferExpired  = "expired"
+	// a draft the recruiter dropped before sending it
+	OfferWithdrawn = "withdrawn"
+)
+
+// Offer represents the terms a recruiter offers to a candidate for an application
+type Offer struct {
+	Id            int        `json:"id"`
+	ApplicationId int        `json:"application_id"`
+	Salary        int        `json:"salary"`
+	Currency      string     `json:"currency"`
+	StartDate     time.Time  `json:"start_date"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	Terms         string     `json:"terms"`
+	Status        string     `json:"status"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	RespondedAt   *time.Time `json:"responded_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type OfferModel struct {
+	DB *sql.DB
+}
+
+// ValidateOffer checks the offer terms before they are stored
+func ValidateOffer(v *validator.Validator, offer *Offer) {
+	v.CheckCode(offer.Salary > 0, "salary", validator.CodeGreaterThan, 0)
+
+	// ISO 4217 codes like "EUR" or "USD"
+	v.Check(len(offer.Currency) == 3, "currency", "must be a 3 letter currency code")
+
+	v.CheckCode(!offer.StartDate.IsZero(), "start_date", validator.CodeRequired)
+
+	v.CheckCode(!offer.ExpiresAt.IsZero(), "expires_at", validator.CodeRequired)
+	v.CheckCode(offer.ExpiresAt.After(time.Now()), "expires_at", validator.CodeFuture)
+
+	v.CheckCode(len(offer.Terms) <= 10000, "terms", validator.CodeTooLong, 10000)
+}
+
+// Insert stores a new draft offer
+func (m OfferModel) Insert(ctx context.Context, offer *Offer) error {
+	query := `
+		INSERT INTO offers (application_id, salary, currency, start_date, expires_at, terms, status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'draft')
+		RETURNING id, status, created_at`
+
+	args := []interface{}{offer.ApplicationId, offer.Salary, offer.Currency, offer.StartDate, offer.ExpiresAt, offer.Terms}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&offer.Id, &offer.Status, &offer.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			// the partial unique index allows one draft/sent offer per application
+			if pgErr.Code == "23505" {
+				return ErrOpenOfferExists
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get fetches a single offer by id
+func (m OfferModel) Get(ctx context.Context, id int) (*Offer, error) {
+	query := `
+		SELECT id, application_id, salary, currency, start_date, expires_at, terms, status, sent_at, responded_at, created_at
+		FROM offers
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var offer Offer
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&offer.Id,
+		&offer.ApplicationId,
+		&offer.Salary,
+		&offer.Currency,
+		&offer.StartDate,
+		&offer.ExpiresAt,
+		&offer.Terms,
+		&offer.Status,
+		&offer.SentAt,
+		&offer.RespondedAt,
+		&offer.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// Send moves a draft offer to sent and marks the application as offered.
+// Both updates happen in one transaction so they can't drift apart.
+// The application must still be applied or interviewing, it may have been
+// rejected or closed since the offer was drafted
+func (m OfferModel) Send(ctx context.Context, offer *Offer, hooks ...TxFunc) error {
+	query := `
+		UPDATE offers
+		SET status = 'sent', sent_at = NOW()
+		WHERE id = $1 AND status = 'draft' AND expires_at > NOW()
+		RETURNING status, sent_at`
+
+	return m.transition(ctx, offer, query, StatusOffered, []string{StatusApplied, StatusInterviewing}, hooks)
+}
+
+// Accept records the candidate accepting a sent offer, the application becomes hired
+func (m OfferModel) Accept(ctx context.Context, offer *Offer, hooks ...TxFunc) error {
+	query := `
+		UPDATE offers
+		SET status = 'accepted', responded_at = NOW()
+		WHERE id = $1 AND status = 'sent' AND expires_at > NOW()
+		RETURNING status, responded_at`
+
+	return m.transition(ctx, offer, query, StatusHired, []string{StatusOffered}, hooks)
+}
+
+// Decline records the candidate declining a sent offer
+func (m OfferModel) Decline(ctx context.Context, offer *Offer, hooks ...TxFunc) error {
+	query := `
+		UPDATE offers
+		SET status = 'declined', responded_at = NOW()
+		WHERE id = $1 AND status = 'sent' AND expires_at > NOW()
+		RETURNING status, responded_at`
+
+	return m.transition(ctx, offer, query, StatusDeclined, []string{StatusOffered}, hooks)
+}
+
+// Withdraw drops a draft offer, which frees the application for a new one.
+// Sent offers can't be withdrawn, the candidate has them already
+func (m OfferModel) Withdraw(ctx context.Context, offer *Offer) error {
+	query := `
+		UPDATE offers
+		SET status = 'withdrawn'
+		WHERE id = $1 AND status = 'draft'
+		RETURNING status`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, offer.Id).Scan(&offer.Status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOfferNotOpen
+		}
+		return err
+	}
+
+	return nil
+}
+
+// transition runs an offer update and the matching application status change in a transaction.
+// the offer query must take the offer id as $1 and return the new status and a timestamp.
+// The application only changes from one of the from statuses, checked as it's updated
+// so a concurrent change to the application can't slip in between
+func (m OfferModel) transition(ctx context.Context, offer *Offer, query string, applicationStatus string, from []string, hooks []TxFunc) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		var at time.Time
+		err := tx.QueryRowContext(ctx, query, offer.Id).Scan(&offer.Status, &at)
+		if err != nil {
+			return err
+		}
+
+		if offer.Status == OfferSent {
+			offer.SentAt = &at
+		} else {
+			offer.RespondedAt = &at
+		}
+
+		result, err := tx.ExecContext(ctx, `UPDATE applications SET status = $1 WHERE id = $2 AND status = ANY($3)`,
+			applicationStatus, offer.ApplicationId, from)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrApplicationNotOpen
+		}
+
+		return nil
+	}, hooks)
+
+	if err != nil {
+		// no row means the offer was in the wrong state or already expired
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOfferNotOpen
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ExpireDue marks every sent offer past its expiry as expired and moves the
+// applications back to interviewing so the recruiter can make a new offer.
+// onExpired runs in the same transaction with the ids of the applications it moved,
+// ones whose status had already moved on from offered keep it and aren't passed.
+// Drafts past their expiry are expired too, they can't be sent anymore and would
+// otherwise keep the application from getting a new offer. Their applications
+// never changed, so they aren't passed to onExpired
+func (m OfferModel) ExpireDue(ctx context.Context, onExpired func(ctx context.Context, tx *sql.Tx, applicationIds []int) error) error {
+	query := `
+		WITH expired AS (
+			UPDATE offers
+			SET status = 'expired'
+			WHERE status = 'sent' AND expires_at <= NOW()
+			RETURNING application_id
+		), stale_drafts AS (
+			UPDATE offers
+			SET status = 'expired'
+			WHERE status = 'draft' AND expires_at <= NOW()
+		), reverted AS (
+			UPDATE applications
+			SET status = 'interviewing'
+			WHERE id IN (SELECT application_id FROM expired) AND status = 'offered'
+			RETURNING id
+		)
+		SELECT id FROM reverted`
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		applicationIds := []int{}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			applicationIds = append(applicationIds, id)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if len(applicationIds) == 0 {
+			return nil
+		}
+
+		return onExpired(ctx, tx, applicationIds)
+	}, nil)
+}
+
+// GetAllForApplication returns every offer made on an application, newest first
+func (m OfferModel) GetAllForApplication(ctx context.Context, applicationId int) ([]*Offer, error) {
+	query := `
+		SELECT id, application_id, salary, currency, start_date, expires_at, terms, status, sent_at, responded_at, created_at
+		FROM offers
+		WHERE application_id = $1
+		ORDER BY id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, applicationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []*Offer{}
+	for rows.Next() {
+		var offer Offer
+		err := rows.Scan(
+			&offer.Id,
+			&offer.ApplicationId,
+			&offer.Salary,
+			&offer.Currency,
+			&offer.StartDate,
+			&offer.ExpiresAt,
+			&offer.Terms,
+			&offer.Status,
+			&offer.SentAt,
+			&offer.RespondedAt,
+			&offer.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, &offer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
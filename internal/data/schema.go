@@ -0,0 +1,26 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SchemaModel reads the state golang-migrate keeps in schema_migrations
+type SchemaModel struct {
+	DB *sql.DB
+}
+
+// Version returns the applied migration version, dirty is true when a migration
+// failed halfway. It returns ErrRecordNotFound if no migration has run
+func (m SchemaModel) Version(ctx context.Context) (version int, dirty bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, ErrRecordNotFound
+	}
+	return version, dirty, err
+}
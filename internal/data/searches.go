@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// alert frequencies for a saved search
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+	FrequencyNone    = "none"
+)
+
+// SavedSearch is a named set of GET /jobs query parameters a user wants alerts for
+type SavedSearch struct {
+	Id               int               `json:"id"`
+	UserId           int               `json:"-"`
+	Name             string            `json:"name"`
+	Params           map[string]string `json:"params"`
+	Frequency        string            `json:"frequency"`
+	LastJobId        int               `json:"-"`
+	LastRunAt        *time.Time        `json:"last_run_at"`
+	UnsubscribeToken string            `json:"-"`
+	CreatedAt        time.Time         `json:"created_at"`
+}
+
+// Query returns the params encoded as a GET /jobs query string
+func (s *SavedSearch) Query() url.Values {
+	qs := url.Values{}
+	for key, value := range s.Params {
+		qs.Set(key, value)
+	}
+	return qs
+}
+
+// setQuery fills Params from a stored query string
+func (s *SavedSearch) setQuery(raw string) error {
+	qs, err := url.ParseQuery(raw)
+	if err != nil {
+		return err
+	}
+
+	s.Params = make(map[string]string, len(qs))
+	for key := range qs {
+		s.Params[key] = qs.Get(key)
+	}
+	return nil
+}
+
+type SavedSearchModel struct {
+	DB *sql.DB
+}
+
+// ValidateSavedSearch checks the fields common to every saved search.
+// the params themselves are checked by the handler against what GET /jobs accepts
+func ValidateSavedSearch(v *validator.Validator, search *SavedSearch) {
+	v.CheckCode(search.Name != "", "name", validator.CodeRequired)
+	v.CheckCode(len(search.Name) <= 100, "name", validator.CodeTooLong, 100)
+
+	v.Check(len(search.Params) > 0, "params", "must contain at least one parameter")
+
+	v.CheckCode(validator.PermittedValue(search.Frequency, FrequencyInstant, FrequencyDaily, FrequencyNone), "frequency", validator.CodeOneOf, "instant, daily, none")
+}
+
+// Insert stores a saved search. Alerts only cover jobs posted after this point,
+// so last_job_id starts at the current highest job id.
+func (m SavedSearchModel) Insert(ctx context.Context, search *SavedSearch) error {
+	query := `
+		INSERT INTO saved_searches (user_id, name, query, frequency, unsubscribe_token, last_job_id, last_run_at)
+		VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(id), 0) FROM jobs), NOW())
+		RETURNING id, last_job_id, last_run_at, created_at`
+
+	// the token is only ever sent in alert emails, it identifies the search for one-click unsubscribe
+	search.UnsubscribeToken = rand.Text()
+
+	args := []interface{}{search.UserId, search.Name, search.Query().Encode(), search.Frequency, search.UnsubscribeToken}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&search.Id, &search.LastJobId, &search.LastRunAt, &search.CreatedAt)
+}
+
+// GetAllForUser lists a user's saved searches
+func (m SavedSearchModel) GetAllForUser(ctx context.Context, userId int) ([]*SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, frequency, last_job_id, last_run_at, unsubscribe_token, created_at
+		FROM saved_searches
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	return m.list(ctx, query, userId)
+}
+
+// GetDue returns the searches whose alerts should run now:
+// instant ones every time, daily ones once a day has passed since the last run
+func (m SavedSearchModel) GetDue(ctx context.Context) ([]*SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, frequency, last_job_id, last_run_at, unsubscribe_token, created_at
+		FROM saved_searches
+		WHERE frequency = 'instant'
+		OR (frequency = 'daily' AND (last_run_at IS NULL OR last_run_at <= NOW() - INTERVAL '1 day'))
+		ORDER BY id ASC`
+
+	return m.list(ctx, query)
+}
+
+// MarkRun records that alerts for a search have been handled up to lastJobId, the hooks
+// run in the same transaction so the alert is queued if and only if the run is recorded.
+// It returns ErrRecordNotFound if the search was deleted or another run got to it first,
+// since search was read
+func (m SavedSearchModel) MarkRun(ctx context.Context, search *SavedSearch, lastJobId int, hooks ...TxFunc) error {
+	query := `
+		UPDATE saved_searches
+		SET last_job_id = $2, last_run_at = NOW()
+		WHERE id = $1 AND last_job_id = $3
+		RETURNING last_job_id, last_run_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, query, search.Id, lastJobId, search.LastJobId).Scan(&search.LastJobId, &search.LastRunAt)
+	}, hooks)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Delete removes one of the user's saved searches
+func (m SavedSearchModel) Delete(ctx context.Context, id int, userId int) error {
+	query := `DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetByUnsubscribeToken looks up the search an alert email's unsubscribe link is for
+func (m SavedSearchModel) GetByUnsubscribeToken(ctx context.Context, token string) (*SavedSearch, error) {
+	query := `
+		SELECT id, user_id, name, query, frequency, last_job_id, last_run_at, unsubscribe_token, created_at
+		FROM saved_searches
+		WHERE unsubscribe_token = $1`
+
+	searches, err := m.list(ctx, query, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(searches) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return searches[0], nil
+}
+
+// Unsubscribe turns off alerts for the search the token belongs to
+func (m SavedSearchModel) Unsubscribe(ctx context.Context, token string) (*SavedSearch, error) {
+	query := `
+		UPDATE saved_searches
+		SET frequency = 'none'
+		WHERE unsubscribe_token = $1
+		RETURNING id, user_id, name, query, frequency, last_job_id, last_run_at, unsubscribe_token, created_at`
+
+	searches, err := m.list(ctx, query, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(searches) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return searches[0], nil
+}
+
+// list runs a query returning saved search rows
+func (m SavedSearchModel) list(ctx context.Context, query string, args ...interface{}) ([]*SavedSearch, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []*SavedSearch{}
+	for rows.Next() {
+		var search SavedSearch
+		var rawQuery string
+		err := rows.Scan(
+			&search.Id,
+			&search.UserId,
+			&search.Name,
+			&rawQuery,
+			&search.Frequency,
+			&search.LastJobId,
+			&search.LastRunAt,
+			&search.UnsubscribeToken,
+			&search.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = search.setQuery(rawQuery)
+		if err != nil {
+			return nil, err
+		}
+		searches = append(searches, &search)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return searches, nil
+}
@@ -0,0 +1,163 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Session is a login, every token we issue belongs to one.
+// deleting the session revokes its token
+type Session struct {
+	Id         int       `json:"id"`
+	UserId     int       `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"` // the session making the request
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Insert starts a session
+func (m SessionModel) Insert(ctx context.Context, session *Session) error {
+	query := `
+		INSERT INTO sessions (user_id, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, last_seen_at, created_at`
+
+	session.UserAgent = cleanUserAgent(session.UserAgent)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, session.UserId, session.IP, session.UserAgent, session.ExpiresAt).
+		Scan(&session.Id, &session.LastSeenAt, &session.CreatedAt)
+}
+
+// Active reports whether the user's session exists and hasn't expired
+func (m SessionModel) Active(ctx context.Context, id int, userId int) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND expires_at > NOW())`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var active bool
+	err := m.DB.QueryRowContext(ctx, query, id, userId).Scan(&active)
+	return active, err
+}
+
+// GetAllForUser lists the user's unexpired sessions, most recently used first
+func (m SessionModel) GetAllForUser(ctx context.Context, userId int) ([]*Session, error) {
+	query := `
+		SELECT id, user_id, ip, user_agent, expires_at, last_seen_at, created_at
+		FROM sessions
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.Id,
+			&session.UserId,
+			&session.IP,
+			&session.UserAgent,
+			&session.ExpiresAt,
+			&session.LastSeenAt,
+			&session.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Delete ends one of the user's sessions
+func (m SessionModel) Delete(ctx context.Context, id int, userId int) error {
+	query := `DELETE FROM sessions WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser ends every session the user has, logging them out everywhere
+func (m SessionModel) DeleteAllForUser(ctx context.Context, userId int) error {
+	query := `DELETE FROM sessions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userId)
+	return err
+}
+
+// Touch moves last_seen_at forward for a batch of sessions in one statement
+func (m SessionModel) Touch(ctx context.Context, seen map[int]time.Time) error {
+	if len(seen) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE sessions s
+		SET last_seen_at = t.seen
+		FROM unnest($1::int[], $2::timestamptz[]) AS t(id, seen)
+		WHERE s.id = t.id AND s.last_seen_at < t.seen`
+
+	ids := make([]int, 0, len(seen))
+	times := make([]time.Time, 0, len(seen))
+	for id, at := range seen {
+		ids = append(ids, id)
+		times = append(times, at)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, ids, times)
+	return err
+}
+
+// DeleteExpired removes sessions whose token can no longer be used
+func (m SessionModel) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < NOW()`)
+	return err
+}
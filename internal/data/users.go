@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jackc/pgx/v5/pgconn" // to handle Postgres specific errors
 	"github.com/karnop/gojobs/internal/validator"
@@ -18,12 +19,13 @@ var (
 
 // User represents a registered user
 type User struct {
-	Id        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"` // - means never send in JSON
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	Id         int       `json:"id"`
+	Name       string    `json:"name" validate:"required"`
+	Email      string    `json:"email" validate:"required,email"`
+	Password   password  `json:"-"` // - means never send in JSON
+	Role       string    `json:"role"`
+	MFAEnabled bool      `json:"mfa_enabled"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // password is a custom struct to handle hashing logic
@@ -56,22 +58,31 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyHash is compared against when no user has the email being logged in with
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), 12)
+
+// SimulatePasswordCheck does the same bcrypt work as Matches without a user,
+// so a login for an unknown email takes as long as one with a wrong password
+func SimulatePasswordCheck(plaintextPassword string) {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(plaintextPassword))
+}
+
 // UserModel wraps the DB connection pool
 type UserModel struct {
 	DB *sql.DB
 }
 
 // GetByEmail retrieves a user by their email address
-func (m UserModel) GetByEmail(email string) (*User, error) {
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, role
+		SELECT id, created_at, name, email, password_hash, role, mfa_enabled
 		FROM users
 		WHERE email = $1
 	`
 
 	var user User
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// executing the query
@@ -82,12 +93,13 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Role,
+		&user.MFAEnabled,
 	)
 
 	// handle the user not fund
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("record not found")
+			return nil, ErrRecordNotFound
 		}
 		return nil, err
 	}
@@ -96,14 +108,14 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 }
 
 // Get retrieves a user by their id
-func (m UserModel) Get(id int) (*User, error) {
+func (m UserModel) Get(ctx context.Context, id int) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, role
+        SELECT id, created_at, name, email, password_hash, role, mfa_enabled
         FROM users
         WHERE id = $1`
 
     var user User
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
     defer cancel()
 
     err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -113,11 +125,12 @@ func (m UserModel) Get(id int) (*User, error) {
         &user.Email,
         &user.Password.hash,
         &user.Role,
+        &user.MFAEnabled,
     )
 
     if err != nil {
         if errors.Is(err, sql.ErrNoRows) {
-            return nil, errors.New("record not found")
+            return nil, ErrRecordNotFound
         }
         return nil, err
     }
@@ -126,7 +139,7 @@ func (m UserModel) Get(id int) (*User, error) {
 }
 
 // insert adds a new user to the db
-func (m UserModel) Insert(user *User) error {
+func (m UserModel) Insert(ctx context.Context, user *User) error {
 	query := `
 		INSERT INTO users (name, email, password_hash, role)
 		VALUES ($1, $2, $3, $4)
@@ -135,7 +148,7 @@ func (m UserModel) Insert(user *User) error {
 
 	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Role}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Id, &user.CreatedAt)
@@ -155,13 +168,12 @@ func (m UserModel) Insert(user *User) error {
 
 // ValidateUser checks the request data.
 func ValidateUser(v *validator.Validator, user *User) {
-	v.Check(user.Name != "", "name", "must be provided")
-	v.Check(user.Email != "", "email", "must be provided")
-	v.Check(validator.Matches(user.Email, validator.EmailRX), "email", "must be a valid email address")
+	v.Struct(user)
 
+	// the password has no tags, it's unexported so only its hash is ever stored
 	if user.Password.plaintext != nil {
-		v.Check(*user.Password.plaintext != "", "password", "must be provided")
-		v.Check(len(*user.Password.plaintext) >= 8, "password", "must be at least 8 bytes long")
+		v.CheckCode(*user.Password.plaintext != "", "password", validator.CodeRequired)
+		v.CheckCode(utf8.RuneCountInString(*user.Password.plaintext) >= 8, "password", validator.CodeTooShort, 8)
 	}
 }
 
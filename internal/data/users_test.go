@@ -0,0 +1,41 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+func TestValidateUserPasswordCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string // code, empty for none
+	}{
+		{"long enough", "correct horse", ""},
+		{"too short", "short", validator.CodeTooShort},
+		{"eight characters, more bytes", "pässwörd", ""},
+		{"empty", "", validator.CodeRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Name: "Jane", Email: "jane@example.com"}
+			user.Password.plaintext = &tt.password
+
+			v := validator.New()
+			ValidateUser(v, user)
+
+			errs := v.FieldErrors["password"]
+			if tt.want == "" {
+				if len(errs) != 0 {
+					t.Errorf("password errors = %+v, want none", errs)
+				}
+				return
+			}
+			if len(errs) == 0 || errs[0].Code != tt.want {
+				t.Errorf("password errors = %+v, want %q first", errs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/karnop/gojobs/internal/netguard"
+	"github.com/karnop/gojobs/internal/validator"
+)
+
+// webhook event types
+const (
+	EventJobCreated               = "job.created"
+	EventJobClosed                = "job.closed"
+	EventApplicationCreated       = "application.created"
+	EventApplicationStatusChanged = "application.status_changed"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{EventJobCreated, EventJobClosed, EventApplicationCreated, EventApplicationStatusChanged}
+
+// delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint a recruiter registered to be told about events on their jobs
+type Webhook struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"-"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // only returned when the webhook is created
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent (or waiting to be sent) to a webhook
+type WebhookDelivery struct {
+	Id             int64           `json:"id"`
+	WebhookId      int             `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+
+	// filled in when the delivery is claimed for sending
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// ValidateWebhook checks the endpoint and event subscriptions
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.CheckCode(webhook.URL != "", "url", validator.CodeRequired)
+
+	u, err := url.Parse(webhook.URL)
+	v.CheckCode(err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "", "url", validator.CodeURL)
+	if err == nil && u.Host != "" {
+		v.Check(u.Scheme != "http", "url", "must be an https URL")
+		v.Check(!localHost(u.Hostname()), "url", "must not point to a local or private address")
+	}
+
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	for _, event := range webhook.Events {
+		v.Check(validator.PermittedValue(event, WebhookEvents...), "events", "contains an unknown event")
+	}
+}
+
+// localHost reports whether a webhook host is obviously not on the internet. Hostnames
+// can still resolve to such addresses, the webhook client refuses those when it connects
+func localHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && !netguard.Public(addr)
+}
+
+// Insert registers a webhook and generates its signing secret
+func (m WebhookModel) Insert(ctx context.Context, webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	webhook.Secret = "whsec_" + rand.Text()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, webhook.UserId, webhook.URL, webhook.Secret, webhook.Events).Scan(&webhook.Id, &webhook.CreatedAt)
+}
+
+// Get fetches one of a user's webhooks, the secret is left out
+func (m WebhookModel) Get(ctx context.Context, id int, userId int) (*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, created_at
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+	err := m.DB.QueryRowContext(ctx, query, id, userId).Scan(
+		&webhook.Id,
+		&webhook.UserId,
+		&webhook.URL,
+		pgtype.NewMap().SQLScanner(&webhook.Events),
+		&webhook.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// GetAllForUser lists a user's webhooks, the secrets are left out
+func (m WebhookModel) GetAllForUser(ctx context.Context, userId int) ([]*Webhook, error) {
+	query := `
+		SELECT id, user_id, url, events, created_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	typeMap := pgtype.NewMap()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.Id,
+			&webhook.UserId,
+			&webhook.URL,
+			typeMap.SQLScanner(&webhook.Events),
+			&webhook.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Delete removes one of a user's webhooks along with its delivery log
+func (m WebhookModel) Delete(ctx context.Context, id int, userId int) error {
+	query := `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Enqueue creates a pending delivery of an event for every webhook the owner
+// registered for it. It runs inside the transaction of the write that caused
+// the event so deliveries only exist for changes that committed.
+// payload must be valid JSON.
+func (m WebhookModel) Enqueue(ctx context.Context, tx *sql.Tx, ownerId int, event string, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $2, $3
+		FROM webhooks
+		WHERE user_id = $1 AND $2 = ANY(events)`
+
+	_, err := tx.ExecContext(ctx, query, ownerId, event, string(payload))
+	return err
+}
+
+// GetDeliveries returns a page of a webhook's delivery log, newest first
+func (m WebhookModel) GetDeliveries(ctx context.Context, webhookId int, filters Filters) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at,
+			last_status_code, last_error, delivered_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues a fresh copy of an earlier delivery, the original stays in the log as it was
+func (m WebhookModel) Redeliver(ctx context.Context, webhookId int, deliveryId int64) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload
+		FROM webhook_deliveries
+		WHERE id = $1 AND webhook_id = $2
+		RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var delivery WebhookDelivery
+	err := m.DB.QueryRowContext(ctx, query, deliveryId, webhookId).Scan(
+		&delivery.Id,
+		&delivery.WebhookId,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+// ClaimDue picks up to limit pending deliveries that are due and leases them for
+// a minute so other dispatchers skip them. A delivery whose lease runs out
+// without a result (e.g. the process died mid-send) is simply picked up again.
+func (m WebhookModel) ClaimDue(ctx context.Context, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = NOW() + INTERVAL '1 minute'
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+		AND d.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, w.url, w.secret`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// MarkSucceeded records a delivery the endpoint accepted
+func (m WebhookModel) MarkSucceeded(ctx context.Context, id int64, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'succeeded', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = NOW()
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, statusCode)
+	return err
+}
+
+// MarkAttemptFailed records a failed attempt. If retryIn is zero the delivery
+// has run out of attempts and is marked failed, otherwise it is retried after retryIn.
+// statusCode is 0 when no response was received.
+func (m WebhookModel) MarkAttemptFailed(ctx context.Context, id int64, statusCode int, reason string, retryIn time.Duration) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+			last_status_code = NULLIF($2, 0),
+			last_error = $3,
+			status = CASE WHEN $4::float8 = 0 THEN 'failed' ELSE 'pending' END,
+			next_attempt_at = NOW() + make_interval(secs => $4::float8)
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, statusCode, reason, retryIn.Seconds())
+	return err
+}
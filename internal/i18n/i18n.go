@@ -0,0 +1,78 @@
+// Package i18n translates the API's messages. English is the source language:
+// messages are looked up by their English text, or format string for messages
+// with parameters, and anything without a translation is sent in English.
+package i18n
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+// Supported are the languages we have messages for, the first is the default
+var Supported = []language.Tag{language.English, language.German, language.Spanish}
+
+var (
+	matcher = language.NewMatcher(Supported)
+	cat     = catalog.NewBuilder(catalog.Fallback(language.English))
+
+	// translated holds every English message with a translation,
+	// anything else is passed through untouched
+	translated = map[string]bool{}
+)
+
+func init() {
+	for tag, messages := range map[language.Tag]map[string]string{
+		language.German:  german,
+		language.Spanish: spanish,
+	} {
+		for english, translation := range messages {
+			err := cat.SetString(tag, english, translation)
+			if err != nil {
+				panic(err)
+			}
+			translated[english] = true
+		}
+	}
+}
+
+// Printer renders messages in one language
+type Printer struct {
+	Tag     language.Tag
+	printer *message.Printer
+}
+
+// New returns a Printer for the best match for an Accept-Language header,
+// English when nothing matches or the header is missing or malformed
+func New(acceptLanguage string) Printer {
+	tag := language.English
+
+	preferred, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err == nil && len(preferred) > 0 {
+		// the matched tag can carry extensions from the request, use ours
+		_, index, confidence := matcher.Match(preferred...)
+		if confidence != language.No {
+			tag = Supported[index]
+		}
+	}
+
+	return Printer{
+		Tag:     tag,
+		printer: message.NewPrinter(tag, message.Catalog(cat)),
+	}
+}
+
+// Sprintf formats a message with parameters in the printer's language,
+// numbers are formatted the way the language writes them
+func (p Printer) Sprintf(format string, args ...interface{}) string {
+	return p.printer.Sprintf(format, args...)
+}
+
+// Text translates a message without parameters. Unlike Sprintf, text that isn't in
+// the catalogue is returned as it is, so it's safe to use on any message
+func (p Printer) Text(s string) string {
+	if !translated[s] {
+		return s
+	}
+	return p.printer.Sprintf(s)
+}
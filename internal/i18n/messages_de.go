@@ -0,0 +1,138 @@
+package i18n
+
+// german has the German translations, keyed by the English message
+var german = map[string]string{
+	// status titles
+	"Bad Request":              "Ungültige Anfrage",
+	"Unauthorized":             "Nicht autorisiert",
+	"Forbidden":                "Verboten",
+	"Not Found":                "Nicht gefunden",
+	"Method Not Allowed":       "Methode nicht erlaubt",
+	"Conflict":                 "Konflikt",
+	"Request Entity Too Large": "Anfrage zu groß",
+	"Unprocessable Entity":     "Nicht verarbeitbare Anfrage",
+	"Too Many Requests":        "Zu viele Anfragen",
+	"Internal Server Error":    "Interner Serverfehler",
+	"Service Unavailable":      "Dienst nicht verfügbar",
+
+	// validation, see the formats in internal/validator
+	"must be provided":                      "muss angegeben werden",
+	"must not be more than %d characters":   "darf nicht mehr als %d Zeichen lang sein",
+	"must be at least %d characters long":   "muss mindestens %d Zeichen lang sein",
+	"must not contain more than %d items":   "darf nicht mehr als %d Einträge enthalten",
+	"must contain at least %d items":        "muss mindestens %d Einträge enthalten",
+	"must be greater than %v":               "muss größer als %v sein",
+	"must be greater than or equal to %v":   "muss größer oder gleich %v sein",
+	"must be less than %v":                  "muss kleiner als %v sein",
+	"must be less than or equal to %v":      "muss kleiner oder gleich %v sein",
+	"must be a valid email address":         "muss eine gültige E-Mail-Adresse sein",
+	"must be an absolute http or https URL": "muss eine absolute http- oder https-URL sein",
+	"must be one of %s":                     "muss einer der folgenden Werte sein: %s",
+	"must be in the future":                 "muss in der Zukunft liegen",
+	"is already in use":                     "ist bereits vergeben",
+	"contains an unknown value %q":          "enthält einen unbekannten Wert %q",
+
+	"must contain at least one event":              "muss mindestens ein Ereignis enthalten",
+	"contains an unknown event":                    "enthält ein unbekanntes Ereignis",
+	"must be an https URL":                         "muss eine https-URL sein",
+	"must not point to a local or private address": "darf nicht auf eine lokale oder private Adresse zeigen",
+	"must contain at least one parameter":          "muss mindestens einen Parameter enthalten",
+	"must be a 3 letter currency code":             "muss ein dreistelliger Währungscode sein",
+	"must be an integer value":                     "muss eine ganze Zahl sein",
+	"must be a date in YYYY-MM-DD format":          "muss ein Datum im Format JJJJ-MM-TT sein",
+
+	// request bodies
+	"body must not be empty":                         "Der Anfragetext darf nicht leer sein",
+	"body contains badly-formed JSON":                "Der Anfragetext enthält fehlerhaftes JSON",
+	"body must only contain a single JSON value":     "Der Anfragetext darf nur einen einzigen JSON-Wert enthalten",
+	`body must contain the "required" field`:         `Der Anfragetext muss das Feld "required" enthalten`,
+	"The request contains invalid fields":            "Die Anfrage enthält ungültige Felder",
+	"The requested resource could not be found":      "Die angeforderte Ressource wurde nicht gefunden",
+	"A user with this email address already exists":  "Es existiert bereits ein Benutzer mit dieser E-Mail-Adresse",
+	"Email and Password required":                    "E-Mail und Passwort sind erforderlich",
+	"mfa_token and a code or recovery_code required": "mfa_token und ein code oder recovery_code sind erforderlich",
+
+	"The server encountered a problem and could not process your request": "Der Server hat ein Problem festgestellt und konnte Ihre Anfrage nicht bearbeiten",
+
+	// authentication
+	"Authorization header required":                          "Authorization-Header erforderlich",
+	"Invalid authorization header format":                    "Ungültiges Format des Authorization-Headers",
+	"Invalid or expired token":                               "Ungültiges oder abgelaufenes Token",
+	"Invalid or expired API key":                             "Ungültiger oder abgelaufener API-Schlüssel",
+	"Invalid user ID in token":                               "Ungültige Benutzer-ID im Token",
+	"Invalid credentials":                                    "Ungültige Anmeldedaten",
+	"Invalid code":                                           "Ungültiger Code",
+	"Session has been logged out":                            "Die Sitzung wurde abgemeldet",
+	"This endpoint cannot be used with an API key":           "Dieser Endpunkt kann nicht mit einem API-Schlüssel verwendet werden",
+	"Too many requests, please try again later":              "Zu viele Anfragen, bitte versuchen Sie es später erneut",
+	"Too many failed login attempts, please try again later": "Zu viele fehlgeschlagene Anmeldeversuche, bitte versuchen Sie es später erneut",
+
+	"Two-factor authentication must be set up first":     "Die Zwei-Faktor-Authentifizierung muss zuerst eingerichtet werden",
+	"Two-factor authentication is already enabled":       "Die Zwei-Faktor-Authentifizierung ist bereits aktiviert",
+	"Two-factor authentication is not enabled":           "Die Zwei-Faktor-Authentifizierung ist nicht aktiviert",
+	"Your company requires two-factor authentication":    "Ihr Unternehmen verlangt die Zwei-Faktor-Authentifizierung",
+	"Start enrolment with POST /users/me/mfa/totp first": "Starten Sie die Einrichtung zuerst mit POST /users/me/mfa/totp",
+
+	"Unknown login provider":                                "Unbekannter Anmeldeanbieter",
+	"Login session expired, please start again":             "Die Anmeldesitzung ist abgelaufen, bitte beginnen Sie erneut",
+	"Invalid login state":                                   "Ungültiger Anmeldestatus",
+	"Login cancelled or refused by the provider":            "Die Anmeldung wurde abgebrochen oder vom Anbieter abgelehnt",
+	"Login with the provider failed":                        "Die Anmeldung beim Anbieter ist fehlgeschlagen",
+	"The provider did not confirm a verified email address": "Der Anbieter hat keine bestätigte E-Mail-Adresse übermittelt",
+
+	// permissions
+	"Only recruiters can post jobs":                                   "Nur Recruiter können Stellen ausschreiben",
+	"Only recruiters can register webhooks":                           "Nur Recruiter können Webhooks registrieren",
+	"Only recruiters can create API keys":                             "Nur Recruiter können API-Schlüssel erstellen",
+	"Only recruiters and admins can enable two-factor authentication": "Nur Recruiter und Administratoren können die Zwei-Faktor-Authentifizierung aktivieren",
+	"Only admins can unlock accounts":                                 "Nur Administratoren können Konten entsperren",
+	"Only admins can set company policies":                            "Nur Administratoren können Unternehmensrichtlinien festlegen",
+	"Only admins can manage company recruiters":                       "Nur Administratoren können die Recruiter eines Unternehmens verwalten",
+	"Only recruiters can be added to a company":                       "Nur Recruiter können einem Unternehmen hinzugefügt werden",
+	"The user is not a recruiter of this company":                     "Der Benutzer ist kein Recruiter dieses Unternehmens",
+	"Only the job's recruiter can make offers":                        "Nur der Recruiter der Stelle kann Angebote machen",
+	"Only the job's recruiter can change an application's status":     "Nur der Recruiter der Stelle kann den Status einer Bewerbung ändern",
+	"Only the job's recruiter can send offers":                        "Nur der Recruiter der Stelle kann Angebote versenden",
+	"Only the job's recruiter can withdraw offers":                    "Nur der Recruiter der Stelle kann Angebote zurückziehen",
+	"Only the job's recruiter can close it":                           "Nur der Recruiter der Stelle kann sie schließen",
+	"Only the candidate can accept an offer":                          "Nur der Bewerber kann ein Angebot annehmen",
+	"Only the candidate can decline an offer":                         "Nur der Bewerber kann ein Angebot ablehnen",
+
+	// lookups
+	"User not found":            "Benutzer nicht gefunden",
+	"Job not found":             "Stelle nicht gefunden",
+	"Application not found":     "Bewerbung nicht gefunden",
+	"Offer not found":           "Angebot nicht gefunden",
+	"Webhook not found":         "Webhook nicht gefunden",
+	"Delivery not found":        "Zustellung nicht gefunden",
+	"Bookmark not found":        "Lesezeichen nicht gefunden",
+	"Saved search not found":    "Gespeicherte Suche nicht gefunden",
+	"Session not found":         "Sitzung nicht gefunden",
+	"API key not found":         "API-Schlüssel nicht gefunden",
+	"Invalid user ID":           "Ungültige Benutzer-ID",
+	"Invalid job ID":            "Ungültige Stellen-ID",
+	"Invalid application ID":    "Ungültige Bewerbungs-ID",
+	"Invalid offer ID":          "Ungültige Angebots-ID",
+	"Invalid webhook ID":        "Ungültige Webhook-ID",
+	"Invalid delivery ID":       "Ungültige Zustellungs-ID",
+	"Invalid saved search ID":   "Ungültige ID der gespeicherten Suche",
+	"Invalid session ID":        "Ungültige Sitzungs-ID",
+	"Invalid API key ID":        "Ungültige API-Schlüssel-ID",
+	"Missing unsubscribe token": "Abmelde-Token fehlt",
+	"Invalid unsubscribe token": "Ungültiges Abmelde-Token",
+
+	// jobs, applications and offers
+	"You have already applied for this job":                        "Sie haben sich bereits auf diese Stelle beworben",
+	"Job is closed to new applications":                            "Die Stelle nimmt keine neuen Bewerbungen mehr an",
+	"Job is already closed":                                        "Die Stelle ist bereits geschlossen",
+	"Application is not open for offers":                           "Für diese Bewerbung können keine Angebote gemacht werden",
+	"Application can't change to this status from its current one": "Die Bewerbung kann von ihrem aktuellen Status nicht in diesen wechseln",
+	"An open offer already exists for this application":            "Für diese Bewerbung gibt es bereits ein offenes Angebot",
+	"Offer is not open for this action":                            "Diese Aktion ist für das Angebot nicht möglich",
+	"Only draft offers can be withdrawn":                           "Nur Angebotsentwürfe können zurückgezogen werden",
+
+	// CORS
+	"This origin is not allowed to call the API":            "Dieser Ursprung darf die API nicht aufrufen",
+	"This method is not allowed for the requested resource": "Diese Methode ist für die angeforderte Ressource nicht erlaubt",
+	"These request headers are not allowed":                 "Diese Anfrage-Header sind nicht erlaubt",
+}
@@ -0,0 +1,138 @@
+package i18n
+
+// spanish has the Spanish translations, keyed by the English message
+var spanish = map[string]string{
+	// status titles
+	"Bad Request":              "Solicitud incorrecta",
+	"Unauthorized":             "No autorizado",
+	"Forbidden":                "Prohibido",
+	"Not Found":                "No encontrado",
+	"Method Not Allowed":       "Método no permitido",
+	"Conflict":                 "Conflicto",
+	"Request Entity Too Large": "Solicitud demasiado grande",
+	"Unprocessable Entity":     "Entidad no procesable",
+	"Too Many Requests":        "Demasiadas solicitudes",
+	"Internal Server Error":    "Error interno del servidor",
+	"Service Unavailable":      "Servicio no disponible",
+
+	// validation, see the formats in internal/validator
+	"must be provided":                      "es obligatorio",
+	"must not be more than %d characters":   "no debe tener más de %d caracteres",
+	"must be at least %d characters long":   "debe tener al menos %d caracteres",
+	"must not contain more than %d items":   "no debe contener más de %d elementos",
+	"must contain at least %d items":        "debe contener al menos %d elementos",
+	"must be greater than %v":               "debe ser mayor que %v",
+	"must be greater than or equal to %v":   "debe ser mayor o igual que %v",
+	"must be less than %v":                  "debe ser menor que %v",
+	"must be less than or equal to %v":      "debe ser menor o igual que %v",
+	"must be a valid email address":         "debe ser una dirección de correo electrónico válida",
+	"must be an absolute http or https URL": "debe ser una URL http o https absoluta",
+	"must be one of %s":                     "debe ser uno de los siguientes valores: %s",
+	"must be in the future":                 "debe estar en el futuro",
+	"is already in use":                     "ya está en uso",
+	"contains an unknown value %q":          "contiene un valor desconocido %q",
+
+	"must contain at least one event":              "debe contener al menos un evento",
+	"contains an unknown event":                    "contiene un evento desconocido",
+	"must be an https URL":                         "debe ser una URL https",
+	"must not point to a local or private address": "no debe apuntar a una dirección local o privada",
+	"must contain at least one parameter":          "debe contener al menos un parámetro",
+	"must be a 3 letter currency code":             "debe ser un código de moneda de 3 letras",
+	"must be an integer value":                     "debe ser un número entero",
+	"must be a date in YYYY-MM-DD format":          "debe ser una fecha en formato AAAA-MM-DD",
+
+	// request bodies
+	"body must not be empty":                         "El cuerpo de la solicitud no debe estar vacío",
+	"body contains badly-formed JSON":                "El cuerpo de la solicitud contiene JSON mal formado",
+	"body must only contain a single JSON value":     "El cuerpo de la solicitud solo debe contener un único valor JSON",
+	`body must contain the "required" field`:         `El cuerpo de la solicitud debe contener el campo "required"`,
+	"The request contains invalid fields":            "La solicitud contiene campos no válidos",
+	"The requested resource could not be found":      "No se ha encontrado el recurso solicitado",
+	"A user with this email address already exists":  "Ya existe un usuario con esta dirección de correo electrónico",
+	"Email and Password required":                    "Se requieren el correo electrónico y la contraseña",
+	"mfa_token and a code or recovery_code required": "Se requieren mfa_token y un code o recovery_code",
+
+	"The server encountered a problem and could not process your request": "El servidor ha tenido un problema y no ha podido procesar su solicitud",
+
+	// authentication
+	"Authorization header required":                          "Se requiere la cabecera Authorization",
+	"Invalid authorization header format":                    "Formato de la cabecera Authorization no válido",
+	"Invalid or expired token":                               "Token no válido o caducado",
+	"Invalid or expired API key":                             "Clave de API no válida o caducada",
+	"Invalid user ID in token":                               "ID de usuario no válido en el token",
+	"Invalid credentials":                                    "Credenciales no válidas",
+	"Invalid code":                                           "Código no válido",
+	"Session has been logged out":                            "La sesión se ha cerrado",
+	"This endpoint cannot be used with an API key":           "Este endpoint no se puede usar con una clave de API",
+	"Too many requests, please try again later":              "Demasiadas solicitudes, inténtelo de nuevo más tarde",
+	"Too many failed login attempts, please try again later": "Demasiados intentos de inicio de sesión fallidos, inténtelo de nuevo más tarde",
+
+	"Two-factor authentication must be set up first":     "Primero debe configurarse la autenticación de dos factores",
+	"Two-factor authentication is already enabled":       "La autenticación de dos factores ya está activada",
+	"Two-factor authentication is not enabled":           "La autenticación de dos factores no está activada",
+	"Your company requires two-factor authentication":    "Su empresa exige la autenticación de dos factores",
+	"Start enrolment with POST /users/me/mfa/totp first": "Inicie primero la configuración con POST /users/me/mfa/totp",
+
+	"Unknown login provider":                                "Proveedor de inicio de sesión desconocido",
+	"Login session expired, please start again":             "La sesión de inicio ha caducado, vuelva a empezar",
+	"Invalid login state":                                   "Estado de inicio de sesión no válido",
+	"Login cancelled or refused by the provider":            "El proveedor ha cancelado o rechazado el inicio de sesión",
+	"Login with the provider failed":                        "Ha fallado el inicio de sesión con el proveedor",
+	"The provider did not confirm a verified email address": "El proveedor no ha confirmado una dirección de correo electrónico verificada",
+
+	// permissions
+	"Only recruiters can post jobs":                                   "Solo los reclutadores pueden publicar ofertas de empleo",
+	"Only recruiters can register webhooks":                           "Solo los reclutadores pueden registrar webhooks",
+	"Only recruiters can create API keys":                             "Solo los reclutadores pueden crear claves de API",
+	"Only recruiters and admins can enable two-factor authentication": "Solo los reclutadores y administradores pueden activar la autenticación de dos factores",
+	"Only admins can unlock accounts":                                 "Solo los administradores pueden desbloquear cuentas",
+	"Only admins can set company policies":                            "Solo los administradores pueden establecer las políticas de la empresa",
+	"Only admins can manage company recruiters":                       "Solo los administradores pueden gestionar los reclutadores de una empresa",
+	"Only recruiters can be added to a company":                       "Solo se pueden añadir reclutadores a una empresa",
+	"The user is not a recruiter of this company":                     "El usuario no es reclutador de esta empresa",
+	"Only the job's recruiter can make offers":                        "Solo el reclutador del empleo puede hacer ofertas",
+	"Only the job's recruiter can change an application's status":     "Solo el reclutador del empleo puede cambiar el estado de una candidatura",
+	"Only the job's recruiter can send offers":                        "Solo el reclutador del empleo puede enviar ofertas",
+	"Only the job's recruiter can withdraw offers":                    "Solo el reclutador del empleo puede retirar ofertas",
+	"Only the job's recruiter can close it":                           "Solo el reclutador del empleo puede cerrarlo",
+	"Only the candidate can accept an offer":                          "Solo el candidato puede aceptar una oferta",
+	"Only the candidate can decline an offer":                         "Solo el candidato puede rechazar una oferta",
+
+	// lookups
+	"User not found":            "Usuario no encontrado",
+	"Job not found":             "Empleo no encontrado",
+	"Application not found":     "Candidatura no encontrada",
+	"Offer not found":           "Oferta no encontrada",
+	"Webhook not found":         "Webhook no encontrado",
+	"Delivery not found":        "Entrega no encontrada",
+	"Bookmark not found":        "Marcador no encontrado",
+	"Saved search not found":    "Búsqueda guardada no encontrada",
+	"Session not found":         "Sesión no encontrada",
+	"API key not found":         "Clave de API no encontrada",
+	"Invalid user ID":           "ID de usuario no válido",
+	"Invalid job ID":            "ID de empleo no válido",
+	"Invalid application ID":    "ID de candidatura no válido",
+	"Invalid offer ID":          "ID de oferta no válido",
+	"Invalid webhook ID":        "ID de webhook no válido",
+	"Invalid delivery ID":       "ID de entrega no válido",
+	"Invalid saved search ID":   "ID de búsqueda guardada no válido",
+	"Invalid session ID":        "ID de sesión no válido",
+	"Invalid API key ID":        "ID de clave de API no válido",
+	"Missing unsubscribe token": "Falta el token de baja",
+	"Invalid unsubscribe token": "Token de baja no válido",
+
+	// jobs, applications and offers
+	"You have already applied for this job":                        "Ya se ha postulado a este empleo",
+	"Job is closed to new applications":                            "El empleo ya no admite candidaturas",
+	"Job is already closed":                                        "El empleo ya está cerrado",
+	"Application is not open for offers":                           "La candidatura no admite ofertas",
+	"Application can't change to this status from its current one": "La candidatura no puede pasar a este estado desde el actual",
+	"An open offer already exists for this application":            "Ya existe una oferta abierta para esta candidatura",
+	"Offer is not open for this action":                            "La oferta no admite esta acción",
+	"Only draft offers can be withdrawn":                           "Solo se pueden retirar los borradores de ofertas",
+
+	// CORS
+	"This origin is not allowed to call the API":            "Este origen no puede llamar a la API",
+	"This method is not allowed for the requested resource": "Este método no está permitido para el recurso solicitado",
+	"These request headers are not allowed":                 "Estas cabeceras de solicitud no están permitidas",
+}
@@ -0,0 +1,223 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is one signing or verification key, identified in token headers by its kid
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer // nil for keys that are only kept to verify older tokens
+	Public  crypto.PublicKey
+}
+
+// Keyring holds the key new tokens are signed with and every key tokens are
+// accepted from. Rotating keys means adding a new private key, making it the
+// signing key and keeping the old one (its public half is enough) until the
+// tokens it signed have expired.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// Load reads every .pem file in dir, the file name without the extension is the kid.
+// Private keys (PKCS#8 or PKCS#1) can sign and verify, public keys (PKIX) only verify.
+// signingId picks the signing key, it can be empty when there is exactly one private key.
+func Load(dir string, signingId string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	kr := &Keyring{keys: make(map[string]*Key)}
+	var private []string
+
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		key, err := readKey(path, id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		kr.keys[id] = key
+		if key.Private != nil {
+			private = append(private, id)
+		}
+	}
+
+	if signingId == "" {
+		if len(private) != 1 {
+			return nil, fmt.Errorf("found %d private keys in %s, set the signing key id", len(private), dir)
+		}
+		signingId = private[0]
+	}
+
+	if !slices.Contains(private, signingId) {
+		return nil, fmt.Errorf("no private key with id %q in %s", signingId, dir)
+	}
+	kr.signing = kr.keys[signingId]
+
+	return kr, nil
+}
+
+// Ephemeral returns a keyring with a single Ed25519 key generated in memory.
+// tokens signed with it stop working when the process exits, it's meant for development
+func Ephemeral() (*Keyring, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:      "ephemeral-" + strings.ToLower(rand.Text()[:8]),
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+		Public:  public,
+	}
+
+	return &Keyring{signing: key, keys: map[string]*Key{key.ID: key}}, nil
+}
+
+// readKey parses a PEM encoded RSA or Ed25519 key
+func readKey(path string, id string) (*Key, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: id}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, k.Public()
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", parsed)
+	}
+
+	if k, ok := key.Public.(*rsa.PublicKey); ok && k.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+
+	return key, nil
+}
+
+// Sign signs claims with the signing key and puts its kid in the header
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.signing.Method, claims)
+	token.Header["kid"] = kr.signing.ID
+
+	return token.SignedString(kr.signing.Private)
+}
+
+// Keyfunc finds the key a token was signed with from its kid,
+// the token's alg has to be the one that key is used with
+func (kr *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// Methods lists the algorithms of the keys in the ring
+func (kr *Keyring) Methods() []string {
+	var methods []string
+	for _, key := range kr.keys {
+		if !slices.Contains(methods, key.Method.Alg()) {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+	return methods
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS returns the public half of every key, for other services to verify our tokens with
+func (kr *Keyring) JWKS() []JWK {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	jwks := make([]JWK, 0, len(ids))
+	for _, id := range ids {
+		key := kr.keys[id]
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch k := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	return jwks
+}
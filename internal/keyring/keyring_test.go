@@ -0,0 +1,319 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// test keys, generating RSA keys is slow so each size is made once
+var (
+	rsaKey, _          = rsa.GenerateKey(rand.Reader, 2048)
+	smallRSAKey, _     = rsa.GenerateKey(rand.Reader, 1024)
+	edPublic, edKey, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+func pemBytes(t *testing.T, blockType string, der []byte) []byte {
+	t.Helper()
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func pkcs8(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pemBytes(t, "PRIVATE KEY", der)
+}
+
+func pkix(t *testing.T, key interface{}) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pemBytes(t, "PUBLIC KEY", der)
+}
+
+// keyDir writes files, named by kid, into a new directory
+func keyDir(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		err := os.WriteFile(filepath.Join(dir, name), contents, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string][]byte
+		signingId  string
+		wantSigner string
+		wantKeys   map[string]string // kid to alg
+		wantErr    string
+	}{
+		{
+			name:       "RSA PKCS#8",
+			files:      map[string][]byte{"rsa.pem": pkcs8(t, rsaKey)},
+			wantSigner: "rsa",
+			wantKeys:   map[string]string{"rsa": "RS256"},
+		},
+		{
+			name:       "RSA PKCS#1",
+			files:      map[string][]byte{"rsa1.pem": pemBytes(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+			wantSigner: "rsa1",
+			wantKeys:   map[string]string{"rsa1": "RS256"},
+		},
+		{
+			name:       "Ed25519",
+			files:      map[string][]byte{"ed.pem": pkcs8(t, edKey)},
+			wantSigner: "ed",
+			wantKeys:   map[string]string{"ed": "EdDSA"},
+		},
+		{
+			name: "rotation, old public keys verify only",
+			files: map[string][]byte{
+				"2024.pem":  pkix(t, &rsaKey.PublicKey),
+				"2025.pem":  pkix(t, edPublic),
+				"2026.pem":  pkcs8(t, edKey),
+				"notes.txt": []byte("not a key"),
+			},
+			wantSigner: "2026",
+			wantKeys:   map[string]string{"2024": "RS256", "2025": "EdDSA", "2026": "EdDSA"},
+		},
+		{
+			name:       "signing id picks between private keys",
+			files:      map[string][]byte{"a.pem": pkcs8(t, rsaKey), "b.pem": pkcs8(t, edKey)},
+			signingId:  "b",
+			wantSigner: "b",
+			wantKeys:   map[string]string{"a": "RS256", "b": "EdDSA"},
+		},
+		{
+			name:    "two private keys and no signing id",
+			files:   map[string][]byte{"a.pem": pkcs8(t, rsaKey), "b.pem": pkcs8(t, edKey)},
+			wantErr: "found 2 private keys",
+		},
+		{
+			name:      "signing id is a public key",
+			files:     map[string][]byte{"a.pem": pkcs8(t, edKey), "b.pem": pkix(t, edPublic)},
+			signingId: "b",
+			wantErr:   `no private key with id "b"`,
+		},
+		{
+			name:      "unknown signing id",
+			files:     map[string][]byte{"a.pem": pkcs8(t, edKey)},
+			signingId: "c",
+			wantErr:   `no private key with id "c"`,
+		},
+		{
+			name:    "no keys",
+			files:   map[string][]byte{},
+			wantErr: "found 0 private keys",
+		},
+		{
+			name:    "not PEM",
+			files:   map[string][]byte{"bad.pem": []byte("-----BEGIN nothing")},
+			wantErr: "no PEM data found",
+		},
+		{
+			name:    "PEM that isn't a key",
+			files:   map[string][]byte{"cert.pem": pemBytes(t, "CERTIFICATE", []byte{1, 2, 3})},
+			wantErr: `unsupported PEM block "CERTIFICATE"`,
+		},
+		{
+			name:    "corrupt key",
+			files:   map[string][]byte{"bad.pem": pemBytes(t, "PRIVATE KEY", []byte("garbage"))},
+			wantErr: "bad.pem",
+		},
+		{
+			name:    "RSA key too small",
+			files:   map[string][]byte{"small.pem": pkcs8(t, smallRSAKey)},
+			wantErr: "at least 2048 bits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := Load(keyDir(t, tt.files), tt.signingId)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error: %v", err)
+			}
+
+			if kr.signing.ID != tt.wantSigner {
+				t.Errorf("signing key = %q, want %q", kr.signing.ID, tt.wantSigner)
+			}
+			if len(kr.keys) != len(tt.wantKeys) {
+				t.Errorf("loaded %d keys, want %d", len(kr.keys), len(tt.wantKeys))
+			}
+			for kid, alg := range tt.wantKeys {
+				key, ok := kr.keys[kid]
+				if !ok {
+					t.Errorf("key %q not loaded", kid)
+					continue
+				}
+				if key.ID != kid || key.Method.Alg() != alg {
+					t.Errorf("key %q = %q %s, want %s", kid, key.ID, key.Method.Alg(), alg)
+				}
+			}
+		})
+	}
+}
+
+func TestSignKeyfunc(t *testing.T) {
+	claims := jwt.MapClaims{"sub": "42"}
+
+	// old keys are still accepted after rotating to a new signing key
+	oldDir := keyDir(t, map[string][]byte{"old.pem": pkcs8(t, rsaKey)})
+	old, err := Load(oldDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := old.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := Load(keyDir(t, map[string][]byte{
+		"old.pem": pkix(t, &rsaKey.PublicKey),
+		"new.pem": pkcs8(t, edKey),
+	}), "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := kr.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a token claiming the new kid but signed by another Ed25519 key
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	forged.Header["kid"] = "new"
+	forgedToken, err := forged.SignedString(otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 keyed with the public key's bytes, the classic alg confusion attack
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = "new"
+	confusedToken, err := confused.SignedString([]byte(edPublic))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	unknown.Header["kid"] = "missing"
+	unknownToken, err := unknown.SignedString(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantKid string
+		wantOK  bool
+	}{
+		{"signed with the signing key", newToken, "new", true},
+		{"signed with a rotated out key", oldToken, "old", true},
+		{"signed with a different key", forgedToken, "", false},
+		{"alg doesn't match the key", confusedToken, "", false},
+		{"unknown kid", unknownToken, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(tt.token, kr.Keyfunc)
+			if tt.wantOK != (err == nil) {
+				t.Fatalf("Parse() error = %v, want ok %v", err, tt.wantOK)
+			}
+			if !tt.wantOK {
+				return
+			}
+
+			if kid := token.Header["kid"]; kid != tt.wantKid {
+				t.Errorf("kid = %v, want %s", kid, tt.wantKid)
+			}
+			if sub, _ := token.Claims.GetSubject(); sub != "42" {
+				t.Errorf("sub = %q, want 42", sub)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	kr, err := Load(keyDir(t, map[string][]byte{
+		"b-rsa.pem": pkix(t, &rsaKey.PublicKey),
+		"a-ed.pem":  pkcs8(t, edKey),
+	}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := kr.JWKS()
+	if len(jwks) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(jwks))
+	}
+
+	decode := func(field, s string) []byte {
+		t.Helper()
+		if strings.ContainsAny(s, "+/=") {
+			t.Errorf("%s = %q, want unpadded base64url", field, s)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Errorf("%s = %q: %v", field, s, err)
+		}
+		return b
+	}
+
+	// sorted by kid
+	ed, rsaJWK := jwks[0], jwks[1]
+
+	if ed.Kid != "a-ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x := decode("x", ed.X); string(x) != string(edPublic) {
+		t.Errorf("x = %x, want %x", x, []byte(edPublic))
+	}
+	if ed.N != "" || ed.E != "" {
+		t.Errorf("Ed25519 JWK has RSA fields: %+v", ed)
+	}
+
+	if rsaJWK.Kid != "b-rsa" || rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	if n := new(big.Int).SetBytes(decode("n", rsaJWK.N)); n.Cmp(rsaKey.N) != 0 {
+		t.Errorf("n doesn't match the key's modulus")
+	}
+	if rsaJWK.E != "AQAB" {
+		t.Errorf("e = %q, want AQAB (65537)", rsaJWK.E)
+	}
+	if rsaJWK.Crv != "" || rsaJWK.X != "" {
+		t.Errorf("RSA JWK has OKP fields: %+v", rsaJWK)
+	}
+}
@@ -0,0 +1,199 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// the email templates are compiled into the binary
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends a templated email to a single recipient
+// handlers and tasks depend on this interface so the delivery mechanism can be swapped
+type Mailer interface {
+	// Send renders templateFile from the templates directory with data and delivers it.
+	// each template file defines "subject", "plainBody" and "htmlBody", and emails
+	// people can unsubscribe from also "listUnsubscribe" with the URL that does it.
+	Send(ctx context.Context, recipient, templateFile string, data interface{}) error
+}
+
+// Email is a rendered email ready to be delivered
+type Email struct {
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+	// ListUnsubscribe is an https URL that unsubscribes with a POST (RFC 8058)
+	ListUnsubscribe string
+}
+
+// Render executes the three templates defined in templateFile.
+// the plain text parts use text/template so nothing is HTML escaped in them
+func Render(templateFile string, data interface{}) (*Email, error) {
+	path := "templates/" + templateFile
+
+	textTmpl, err := texttemplate.New("email").ParseFS(templateFS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, path)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	listUnsubscribe := new(bytes.Buffer)
+	if textTmpl.Lookup("listUnsubscribe") != nil {
+		err = textTmpl.ExecuteTemplate(listUnsubscribe, "listUnsubscribe", data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Email{
+		Subject:         strings.TrimSpace(subject.String()),
+		PlainBody:       plainBody.String(),
+		HTMLBody:        htmlBody.String(),
+		ListUnsubscribe: strings.TrimSpace(listUnsubscribe.String()),
+	}, nil
+}
+
+// Bytes builds the multipart/alternative MIME message for the email
+func (e *Email) Bytes(sender, recipient string) ([]byte, error) {
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", sender, err)
+	}
+
+	msg := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+
+	// clients show the last part they understand, so plain text goes first
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", e.PlainBody},
+		{"text/html; charset=UTF-8", e.HTMLBody},
+	}
+
+	for _, part := range parts {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write([]byte(part.content))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// non-ASCII names and subjects are Q-encoded so they survive, in From only the
+	// display name is, the address has to stay readable
+	fmt.Fprintf(msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(msg, "To: %s\r\n", recipient)
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", e.Subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if e.ListUnsubscribe != "" {
+		// mail clients show an unsubscribe button that POSTs to the URL
+		fmt.Fprintf(msg, "List-Unsubscribe: <%s>\r\n", e.ListUnsubscribe)
+		fmt.Fprintf(msg, "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+	}
+	fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(msg, "Content-Type: multipart/alternative; boundary=%q\r\n", mw.Boundary())
+	fmt.Fprintf(msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// LogMailer doesn't send anything, it writes the rendered email to the logger.
+// it's meant for local development where no mail server is available
+type LogMailer struct {
+	Logger *slog.Logger
+}
+
+// Send logs the email instead of delivering it
+func (m LogMailer) Send(ctx context.Context, recipient, templateFile string, data interface{}) error {
+	email, err := Render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.Logger.InfoContext(ctx, "Email sent",
+		"to", recipient,
+		"template", templateFile,
+		"subject", email.Subject,
+		"body", email.PlainBody,
+	)
+	return nil
+}
+
+// FileMailer writes each email as a .eml file into Dir so it can be opened in a mail client
+type FileMailer struct {
+	Dir    string
+	Sender string
+}
+
+// Send writes the email to a new file in Dir
+func (m FileMailer) Send(_ context.Context, recipient, templateFile string, data interface{}) error {
+	email, err := Render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := email.Bytes(m.Sender, recipient)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), strings.TrimSuffix(templateFile, ".tmpl"))
+
+	return os.WriteFile(filepath.Join(m.Dir, name), msg, 0o644)
+}
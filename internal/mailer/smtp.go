@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// defaultSMTPTimeout bounds a whole delivery when SMTPMailer.Timeout isn't set
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPMailer delivers email through an SMTP server.
+// It upgrades to STARTTLS when the server offers it, and leaving Username
+// empty skips authentication so it works against local sinks like MailHog.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string        // e.g. "GoJobs <no-reply@gojobs.dev>"
+	Timeout  time.Duration // for connecting and the whole conversation, a server that stops answering can't hang a worker
+}
+
+// Send renders the template and delivers it as a multipart/alternative message.
+// It gives up when ctx is done or the timeout runs out, whichever is first
+func (m SMTPMailer) Send(ctx context.Context, recipient, templateFile string, data interface{}) error {
+	email, err := Render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := email.Bytes(m.Sender, recipient)
+	if err != nil {
+		return err
+	}
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultSMTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.Host, strconv.Itoa(m.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the deadline covers every read and write, cancelling ctx cuts the connection short
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	return m.deliver(conn, recipient, msg)
+}
+
+// deliver has the SMTP conversation for one message on conn
+func (m SMTPMailer) deliver(conn net.Conn, recipient string, msg []byte) error {
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: m.Host})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	// the envelope sender is the bare address from the From header
+	from := m.Sender
+	if addr, err := parseAddress(m.Sender); err == nil {
+		from = addr
+	}
+
+	err = c.Mail(from)
+	if err != nil {
+		return err
+	}
+	err = c.Rcpt(recipient)
+	if err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// parseAddress returns the address part of "Name <address>"
+func parseAddress(s string) (string, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return a.Address, nil
+}
@@ -0,0 +1,321 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// received is what the sink got in one SMTP conversation
+type received struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// smtpSink is a bare SMTP server on a local port that accepts every message.
+// With silent set it accepts connections but never answers
+type smtpSink struct {
+	ln       net.Listener
+	silent   bool
+	messages chan received
+}
+
+func newSMTPSink(t *testing.T, silent bool) *smtpSink {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{ln: ln, silent: silent, messages: make(chan received, 1)}
+	t.Cleanup(func() { ln.Close() })
+
+	go s.serve()
+	return s
+}
+
+// mailer returns an SMTPMailer sending to the sink
+func (s *smtpSink) mailer(timeout time.Duration) SMTPMailer {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return SMTPMailer{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		Sender:  "GoJobs Büro <no-reply@gojobs.dev>",
+		Timeout: timeout,
+	}
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		if s.silent {
+			// hold the connection open without a greeting until the listener closes
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+			continue
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+
+	var msg received
+	c.PrintfLine("220 sink ready")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			c.PrintfLine("250-sink")
+			c.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			msg.from = envelopeAddress(arg, "FROM:")
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			msg.to = append(msg.to, envelopeAddress(arg, "TO:"))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 go ahead")
+			msg.data, err = c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			c.PrintfLine("250 OK")
+			s.messages <- msg
+		case "QUIT":
+			c.PrintfLine("221 bye")
+			return
+		default:
+			c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// envelopeAddress takes the address out of "FROM:<address> BODY=8BITMIME"
+func envelopeAddress(arg, prefix string) string {
+	addr, _, _ := strings.Cut(strings.TrimPrefix(arg, prefix), " ")
+	return strings.Trim(addr, "<>")
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	sink := newSMTPSink(t, false)
+
+	data := map[string]interface{}{
+		"Name":       "Zoë",
+		"SearchName": "Go & Rust",
+		"Jobs": []map[string]string{
+			{"Title": "Backend Engineer", "Company": "Acme", "URL": "https://gojobs.dev/jobs/7"},
+			{"Title": ".NET Developer", "Company": "Initech", "URL": "https://gojobs.dev/jobs/8"},
+		},
+		"UnsubscribeURL": "https://gojobs.dev/saved-searches/unsubscribe?token=abc",
+	}
+
+	err := sink.mailer(5*time.Second).Send(context.Background(), "zoe@example.com", "job_alert.tmpl", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got received
+	select {
+	case got = <-sink.messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sink received no message")
+	}
+
+	if got.from != "no-reply@gojobs.dev" {
+		t.Errorf("envelope sender = %q, want the bare address", got.from)
+	}
+	if len(got.to) != 1 || got.to[0] != "zoe@example.com" {
+		t.Errorf("envelope recipients = %q", got.to)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(got.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := new(mime.WordDecoder)
+	headers := []struct {
+		name string
+		want string
+	}{
+		{"From", "GoJobs Büro <no-reply@gojobs.dev>"},
+		{"To", "zoe@example.com"},
+		{"Subject", `2 new jobs for "Go & Rust"`},
+		{"MIME-Version", "1.0"},
+		{"List-Unsubscribe", "<https://gojobs.dev/saved-searches/unsubscribe?token=abc>"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+	}
+	for _, h := range headers {
+		value, err := decoder.DecodeHeader(msg.Header.Get(h.name))
+		if err != nil {
+			t.Errorf("%s: %v", h.name, err)
+			continue
+		}
+		if value != h.want {
+			t.Errorf("%s = %q, want %q", h.name, value, h.want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+
+	parts := []struct {
+		contentType string
+		want        []string
+	}{
+		{"text/plain; charset=UTF-8", []string{"Hi Zoë,", `"Go & Rust"`, "- .NET Developer at Initech", "https://gojobs.dev/jobs/8"}},
+		{"text/html; charset=UTF-8", []string{"Hi Zoë,", "Go &amp; Rust", `<a href="https://gojobs.dev/jobs/7">Backend Engineer</a>`}},
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range parts {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("%s part: %v", want.contentType, err)
+		}
+		if ct := part.Header.Get("Content-Type"); ct != want.contentType {
+			t.Errorf("part Content-Type = %q, want %q", ct, want.contentType)
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want.want {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%s part doesn't contain %q:\n%s", want.contentType, s, body)
+			}
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("want two parts, the next one gave %v", err)
+	}
+}
+
+func TestSMTPMailerSendGivesUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{"timeout", 200 * time.Millisecond, func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(context.Background())
+		}},
+		{"context", time.Minute, func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 200*time.Millisecond)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := newSMTPSink(t, true)
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			err := sink.mailer(tt.timeout).Send(ctx, "zoe@example.com", "new_login.tmpl", map[string]interface{}{})
+			if err == nil {
+				t.Fatal("Send to a server that never answers succeeded")
+			}
+			var netErr net.Error
+			if !errors.As(err, &netErr) || !netErr.Timeout() {
+				t.Errorf("err = %v, want a timeout", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Send took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerSendUnreachable(t *testing.T) {
+	// a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m := SMTPMailer{Host: "127.0.0.1", Port: port, Sender: "no-reply@gojobs.dev", Timeout: time.Second}
+	err = m.Send(context.Background(), "zoe@example.com", "new_login.tmpl", map[string]interface{}{})
+	if err == nil {
+		t.Fatalf("Send to 127.0.0.1:%d succeeded", port)
+	}
+}
+
+func TestEmailBytesFrom(t *testing.T) {
+	tests := []struct {
+		sender   string
+		wantName string
+		wantAddr string
+	}{
+		{"GoJobs <no-reply@gojobs.dev>", "GoJobs", "no-reply@gojobs.dev"},
+		{"GoJobs Büro <no-reply@gojobs.dev>", "GoJobs Büro", "no-reply@gojobs.dev"},
+		{`"Acme, Inc." <jobs@acme.example>`, "Acme, Inc.", "jobs@acme.example"},
+		{"no-reply@gojobs.dev", "", "no-reply@gojobs.dev"},
+	}
+
+	email := &Email{Subject: "Hi", PlainBody: "Hi", HTMLBody: "<p>Hi</p>"}
+
+	for _, tt := range tests {
+		t.Run(tt.sender, func(t *testing.T) {
+			raw, err := email.Bytes(tt.sender, "zoe@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// only the display name may be encoded, mail servers read the address
+			header := msg.Header.Get("From")
+			if !strings.Contains(header, tt.wantAddr) {
+				t.Errorf("From = %q, the address isn't readable", header)
+			}
+
+			from, err := msg.Header.AddressList("From")
+			if err != nil || len(from) != 1 {
+				t.Fatalf("From = %q doesn't parse: %v", header, err)
+			}
+			if from[0].Name != tt.wantName || from[0].Address != tt.wantAddr {
+				t.Errorf("From = %q %q, want %q %q", from[0].Name, from[0].Address, tt.wantName, tt.wantAddr)
+			}
+		})
+	}
+
+	_, err := email.Bytes("GoJobs no-reply@gojobs.dev", "zoe@example.com")
+	if err == nil {
+		t.Error("Bytes() with an unparseable sender succeeded, want an error")
+	}
+}
@@ -0,0 +1,251 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "gojobs"
+
+// testProvider serves discovery, JWKS and token for a single authorization code.
+// Tests change the ID token claims it issues through claims
+type testProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string // the code_challenge the code was issued for
+	claims    jwt.MapClaims
+	issuer    string // published in the discovery document, the server URL unless set
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := p.issuer
+		if issuer == "" {
+			issuer = p.server.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// authorize issues the code for a PKCE challenge and the ID token claims for nonce
+func (p *testProvider) authorize(challenge, nonce string) {
+	now := time.Now()
+	p.challenge = challenge
+	p.claims = jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          "zoe@example.com",
+		"email_verified": true,
+		"name":           "Zoë",
+	}
+}
+
+// token checks the client and the PKCE verifier like a real provider does
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientId, secret, _ := r.BasicAuth()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != "the-code" ||
+		clientId != testClientID || secret != "s3cret" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims)
+	token.Header["kid"] = "test-key"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+}
+
+func (p *testProvider) client() *Provider {
+	return NewProvider(Config{
+		Name:         "test",
+		Issuer:       p.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://api.gojobs.dev/auth/test/callback",
+		Scopes:       []string{"openid", "email"},
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p := newTestProvider(t)
+
+	authURL, err := p.client().AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != p.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s", got)
+	}
+
+	sum := sha256.Sum256([]byte("the-verifier"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://api.gojobs.dev/auth/test/callback",
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	qs := u.Query()
+	for param, value := range want {
+		if qs.Get(param) != value {
+			t.Errorf("%s = %q, want %q", param, qs.Get(param), value)
+		}
+	}
+	if strings.Contains(authURL, "the-verifier") {
+		t.Error("the PKCE verifier itself is in the URL")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	verifier := NewVerifier()
+
+	tests := []struct {
+		name     string
+		setup    func(p *testProvider)
+		verifier string
+		nonce    string
+		wantErr  string
+	}{
+		{name: "valid", verifier: verifier, nonce: "the-nonce"},
+		{name: "wrong PKCE verifier", verifier: NewVerifier(), nonce: "the-nonce", wantErr: "invalid_grant"},
+		{name: "nonce mismatch", verifier: verifier, nonce: "another-nonce", wantErr: "nonce mismatch"},
+		{name: "no nonce", verifier: verifier, nonce: "the-nonce", wantErr: "nonce mismatch",
+			setup: func(p *testProvider) { delete(p.claims, "nonce") }},
+		{name: "other audience", verifier: verifier, nonce: "the-nonce", wantErr: "audience",
+			setup: func(p *testProvider) { p.claims["aud"] = "someone-else" }},
+		{name: "other issuer", verifier: verifier, nonce: "the-nonce", wantErr: "issuer",
+			setup: func(p *testProvider) { p.claims["iss"] = "https://evil.example.com" }},
+		{name: "expired", verifier: verifier, nonce: "the-nonce", wantErr: "expired",
+			setup: func(p *testProvider) { p.claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "discovery for another issuer", verifier: verifier, nonce: "the-nonce", wantErr: "does not match",
+			setup: func(p *testProvider) { p.issuer = "https://evil.example.com" }},
+		{name: "no subject", verifier: verifier, nonce: "the-nonce", wantErr: "no subject",
+			setup: func(p *testProvider) { delete(p.claims, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProvider(t)
+			p.authorize(challenge(verifier), "the-nonce")
+			if tt.setup != nil {
+				tt.setup(p)
+			}
+
+			claims, err := p.client().Exchange(context.Background(), "the-code", tt.verifier, tt.nonce)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "subject-1" || claims.Email != "zoe@example.com" || claims.Name != "Zoë" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		wantEmail string
+		wantOK    bool
+	}{
+		{"verified", jwt.MapClaims{"email": "zoe@example.com", "email_verified": true}, "zoe@example.com", true},
+		{"not verified", jwt.MapClaims{"email": "zoe@example.com", "email_verified": false}, "", false},
+		{"no email_verified claim", jwt.MapClaims{"email": "zoe@example.com"}, "", false},
+		{"no email", jwt.MapClaims{"email_verified": true}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier()
+			p := newTestProvider(t)
+			p.authorize(challenge(verifier), "the-nonce")
+			delete(p.claims, "email")
+			delete(p.claims, "email_verified")
+			for claim, value := range tt.claims {
+				p.claims[claim] = value
+			}
+
+			claims, err := p.client().Exchange(context.Background(), "the-code", verifier, "the-nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			email, ok := claims.VerifiedEmail()
+			if email != tt.wantEmail || ok != tt.wantOK {
+				t.Errorf("VerifiedEmail() = %q, %v, want %q, %v", email, ok, tt.wantEmail, tt.wantOK)
+			}
+		})
+	}
+}
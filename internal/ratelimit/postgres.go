@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps buckets in the rate_limits table so every API instance
+// shares them. Each Take is a single upsert, the row lock serialises
+// concurrent requests for the same key.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+// Take counts a request against the key's bucket
+func (s PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	// a request is allowed when the refilled bucket holds at least one token
+	query := `
+		INSERT INTO rate_limits AS b (key, tokens, allowed, updated_at, expires_at)
+		VALUES ($1, $3::float8 - 1, TRUE, NOW(), NOW() + make_interval(secs => $3::float8 / $2::float8))
+		ON CONFLICT (key) DO UPDATE
+		SET tokens = CASE WHEN ` + refilled + ` >= 1 THEN ` + refilled + ` - 1 ELSE ` + refilled + ` END,
+			allowed = ` + refilled + ` >= 1,
+			updated_at = NOW(),
+			expires_at = NOW() + make_interval(secs => $3::float8 / $2::float8)
+		RETURNING tokens, allowed`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var tokens float64
+	var allowed bool
+
+	err := s.DB.QueryRowContext(ctx, query, key, limit.Rate, float64(limit.Burst)).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return newResult(limit, tokens, allowed), nil
+}
+
+// refilled is the bucket topped up for the time since its last request, capped at the burst
+const refilled = `LEAST($3::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $2::float8)`
+
+// DeleteExpired removes buckets that have refilled, a missing bucket is the same as a full one
+func (s PostgresStore) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM rate_limits WHERE expires_at < NOW()`)
+	return err
+}
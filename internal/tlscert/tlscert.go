@@ -0,0 +1,148 @@
+// Package tlscert serves a TLS certificate and key from files, reloading them when
+// they change so a renewed certificate is picked up without restarting the server.
+package tlscert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds the certificate loaded from CertFile and KeyFile.
+// Use its GetCertificate in a tls.Config and call Run to watch the files
+type Reloader struct {
+	CertFile string
+	KeyFile  string
+	Logger   *slog.Logger
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	stamp  [2]fileStamp // of the certificate and the key when they were loaded
+	failed [2]fileStamp // of the last pair that didn't load, it isn't tried again
+}
+
+// fileStamp tells whether a file changed, renewal tools replace files or symlinks
+// so the modification time or the size changes
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New loads the certificate, so a server with a missing or broken one doesn't start
+func New(certFile, keyFile string, logger *slog.Logger) (*Reloader, error) {
+	r := &Reloader{CertFile: certFile, KeyFile: keyFile, Logger: logger}
+
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("TLS certificate loaded", r.logAttrs()...)
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run checks the files every interval until ctx is cancelled and loads them again
+// when they have changed. While a pair doesn't load, like a certificate written before
+// its key, the old certificate is served, the pair is tried again once a file changes
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			r.Logger.Error("Cannot reload TLS certificate, still serving the previous one", "cert_file", r.CertFile, "error", err)
+		} else if reloaded {
+			r.Logger.Info("TLS certificate reloaded", r.logAttrs()...)
+		}
+	}
+}
+
+// reload loads the files if they changed since the last load, it reports whether it did
+func (r *Reloader) reload() (bool, error) {
+	certStamp, err := stat(r.CertFile)
+	if err != nil {
+		return false, err
+	}
+	keyStamp, err := stat(r.KeyFile)
+	if err != nil {
+		return false, err
+	}
+
+	stamp := [2]fileStamp{certStamp, keyStamp}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && (stamp == r.stamp || stamp == r.failed)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := load(r.CertFile, r.KeyFile)
+	if err != nil {
+		r.mu.Lock()
+		r.failed = stamp
+		r.mu.Unlock()
+		return false, err
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		r.Logger.Warn("TLS certificate has expired", "cert_file", r.CertFile, "not_after", cert.Leaf.NotAfter)
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.stamp = stamp
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// load reads the pair, with the parsed leaf for logging its subject and expiry
+func load(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &cert, nil
+}
+
+func (r *Reloader) logAttrs() []interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return []interface{}{"cert_file", r.CertFile, "subject", r.cert.Leaf.Subject.String(), "not_after", r.cert.Leaf.NotAfter}
+}
+
+func stat(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	if info.IsDir() {
+		return fileStamp{}, errors.New(path + " is a directory")
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
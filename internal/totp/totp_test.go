@@ -0,0 +1,148 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key from RFC 6238 Appendix B, "12345678901234567890"
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8 digit codes, a 6 digit code is the same value mod 10^6
+	tests := []struct {
+		unix int64
+		rfc  string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		want := tt.rfc[len(tt.rfc)-digits:]
+
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d) error: %v", tt.unix, err)
+		}
+		if got != want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, want)
+		}
+
+		// lower case secrets, as some apps show them, decode the same
+		got, err = Code(strings.ToLower(rfcSecret), Step(time.Unix(tt.unix, 0)))
+		if err != nil || got != want {
+			t.Errorf("Code(%d) with a lower case secret = %s, %v, want %s", tt.unix, got, err, want)
+		}
+	}
+}
+
+func TestCodeBadSecret(t *testing.T) {
+	_, err := Code("not base32!", 1)
+	if err == nil {
+		t.Error("Code() with a bad secret succeeded, want an error")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	codeAt := func(offset int64) string {
+		code, err := Code(rfcSecret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(0), 1, step, true},
+		{"surrounding spaces", " " + codeAt(0) + " ", 1, step, true},
+		{"one step behind", codeAt(-1), 1, step - 1, true},
+		{"one step ahead", codeAt(1), 1, step + 1, true},
+		{"two steps behind, skew 1", codeAt(-2), 1, 0, false},
+		{"two steps ahead, skew 1", codeAt(2), 1, 0, false},
+		{"two steps behind, skew 2", codeAt(-2), 2, step - 2, true},
+		{"one step behind, no skew", codeAt(-1), 0, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", codeAt(0)[:5], 1, 0, false},
+		{"too long", codeAt(0) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Validate(rfcSecret, tt.code, now, tt.skew)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateSameStepWithinPeriod(t *testing.T) {
+	// a code checked twice within its step reports the same step, which is
+	// what lets the caller refuse it the second time
+	start := time.Unix(1111111110, 0) // first second of a step
+	code, err := Code(rfcSecret, Step(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, start, 1)
+	if !ok {
+		t.Fatal("Validate() at the start of the step failed")
+	}
+
+	second, ok := Validate(rfcSecret, code, start.Add(period*time.Second-time.Second), 1)
+	if !ok || second != first {
+		t.Errorf("Validate() later in the step = %d, %v, want %d, true", second, ok, first)
+	}
+
+	// and in the next step it still matches, through the skew, as the same step
+	next, ok := Validate(rfcSecret, code, start.Add(period*time.Second), 1)
+	if !ok || next != first {
+		t.Errorf("Validate() in the next step = %d, %v, want %d, true", next, ok, first)
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("GenerateSecret() returned the same secret twice")
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateSecret() = %q, decodes to %d bytes, %v, want 20 bytes", a, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Go Jobs", "jane@example.com", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/Go%20Jobs:jane@example.com?algorithm=SHA1&digits=6&issuer=Go+Jobs&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("URI() = %s, want %s", got, want)
+	}
+}
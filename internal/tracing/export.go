@@ -0,0 +1,305 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Tracer batches finished spans and hands them to its exporter in the background
+type Tracer struct {
+	Exporter Exporter
+	Logger   *slog.Logger
+
+	// BatchSize spans are exported together, or whatever has ended after Interval
+	BatchSize int
+	Interval  time.Duration
+
+	mu     sync.RWMutex // guards closing spans
+	closed bool
+	spans  chan *Span
+	done   chan struct{}
+}
+
+// NewTracer returns a running tracer, call Shutdown to export what's left on exit
+func NewTracer(exporter Exporter, logger *slog.Logger) *Tracer {
+	t := &Tracer{
+		Exporter:  exporter,
+		Logger:    logger,
+		BatchSize: 512,
+		Interval:  5 * time.Second,
+		spans:     make(chan *Span, 2048),
+		done:      make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// queue never blocks the request, spans are dropped when the exporter can't keep up
+func (t *Tracer) queue(s *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.spans <- s:
+	default:
+		t.Logger.Warn("Trace queue full, span dropped", "span", s.name)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.BatchSize)
+	for {
+		select {
+		case s, ok := <-t.spans:
+			if !ok {
+				t.export(batch)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= t.BatchSize {
+				t.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			t.export(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (t *Tracer) export(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := t.Exporter.Export(ctx, batch)
+	if err != nil {
+		t.Logger.Error("Trace export failed", "spans", len(batch), "error", err)
+	}
+}
+
+// Shutdown exports the spans that are still queued. Spans ended afterwards are lost
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	defaultTracer.CompareAndSwap(t, nil)
+
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.spans)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StdoutExporter writes each span as a line of JSON, for looking at traces locally
+type StdoutExporter struct {
+	W io.Writer
+}
+
+func (e StdoutExporter) Export(ctx context.Context, spans []*Span) error {
+	enc := json.NewEncoder(e.W)
+	for _, s := range spans {
+		s.mu.Lock()
+		line := map[string]interface{}{
+			"trace_id":    s.sc.TraceID.String(),
+			"span_id":     s.sc.SpanID.String(),
+			"name":        s.name,
+			"kind":        kindNames[s.kind],
+			"start":       s.start,
+			"duration_ms": float64(s.end.Sub(s.start).Microseconds()) / 1000,
+		}
+		if s.parent.IsValid() {
+			line["parent_span_id"] = s.parent.String()
+		}
+		if len(s.attrs) > 0 {
+			attrs := make(map[string]interface{}, len(s.attrs))
+			for _, a := range s.attrs {
+				attrs[a.Key] = a.Value
+			}
+			line["attributes"] = attrs
+		}
+		if s.failed {
+			line["error"] = s.errMessage
+		}
+		s.mu.Unlock()
+
+		err := enc.Encode(line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var kindNames = map[SpanKind]string{KindInternal: "internal", KindServer: "server", KindClient: "client"}
+
+// OTLPExporter posts spans to an OpenTelemetry collector using OTLP/HTTP with JSON encoding
+type OTLPExporter struct {
+	// URL is the traces endpoint, e.g. http://localhost:4318/v1/traces
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+	// ServiceName is sent as the service.name resource attribute
+	ServiceName string
+}
+
+func (e OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("collector answered %s", res.Status)
+	}
+	return nil
+}
+
+// the OTLP JSON mapping of ExportTraceServiceRequest. Ids are hex,
+// 64 bit integers are strings, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 2 is error, unset otherwise
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (e OTLPExporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent.IsValid() {
+			span.ParentSpanID = s.parent.String()
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, otlpAttribute(a.Key, a.Value))
+		}
+		if s.failed {
+			span.Status = otlpStatus{Code: 2, Message: s.errMessage}
+		}
+		s.mu.Unlock()
+
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttr{otlpAttribute("service.name", e.ServiceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/karnop/gojobs"}, Spans: out}},
+	}}}
+}
+
+func otlpAttribute(key string, value interface{}) otlpAttr {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int:
+		v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+	case int64:
+		v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+	case float64:
+		v = map[string]interface{}{"doubleValue": value}
+	case string:
+		v = map[string]interface{}{"stringValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpAttr{Key: key, Value: v}
+}
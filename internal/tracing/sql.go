@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+)
+
+// WrapConnector returns a connector whose connections record a span for every statement
+// run with a context that is inside a span, with the statement and the rows it returned
+// or changed. Use it with sql.OpenDB.
+func WrapConnector(c driver.Connector) driver.Connector {
+	return connector{c}
+}
+
+// Connector opens a connector from a driver that can make one, like pgx's stdlib driver
+func Connector(d driver.Driver, dsn string) (driver.Connector, error) {
+	dc, ok := d.(driver.DriverContext)
+	if !ok {
+		return nil, errors.New("tracing: driver does not implement driver.DriverContext")
+	}
+	c, err := dc.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return WrapConnector(c), nil
+}
+
+type connector struct {
+	driver.Connector
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: inner}, nil
+}
+
+// conn forwards everything to the driver's connection, only Exec and Query are traced.
+// The optional interfaces database/sql looks for fall back to what it does without them
+type conn struct {
+	driver.Conn
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuery(ctx, query)
+	res, err := execer.ExecContext(ctx, query, args)
+	if err == nil {
+		if n, rerr := res.RowsAffected(); rerr == nil {
+			span.SetAttributes("db.rows_affected", n)
+		}
+	}
+	endQuery(span, err)
+
+	return res, err
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil || span == nil {
+		endQuery(span, err)
+		return rows, err
+	}
+
+	// the span ends when the rows are closed, so it covers reading them
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type tracedRows struct {
+	driver.Rows
+	span  *Span
+	count int
+	err   error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+
+	r.span.SetAttributes("db.response.returned_rows", r.count)
+	if r.err == nil {
+		r.err = err
+	}
+	endQuery(r.span, r.err)
+
+	return err
+}
+
+// startQuery starts a client span named after the statement's operation, like "SELECT"
+func startQuery(ctx context.Context, query string) (context.Context, *Span) {
+	if SpanFromContext(ctx) == nil {
+		return ctx, nil
+	}
+
+	statement := strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+
+	ctx, span := StartChild(ctx, strings.ToUpper(operation), KindClient)
+	span.SetAttributes(
+		"db.system", "postgresql",
+		"db.operation.name", strings.ToUpper(operation),
+		"db.query.text", statement,
+	)
+	return ctx, span
+}
+
+func endQuery(span *Span, err error) {
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,73 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error codes, these are part of the API so clients can rely on them not changing
+const (
+	CodeInvalid            = "invalid" // anything without a more specific code, see Check
+	CodeRequired           = "required"
+	CodeTooLong            = "too_long"
+	CodeTooShort           = "too_short"
+	CodeTooMany            = "too_many"
+	CodeTooFew             = "too_few"
+	CodeGreaterThan        = "greater_than"
+	CodeGreaterThanOrEqual = "greater_than_or_equal"
+	CodeLessThan           = "less_than"
+	CodeLessThanOrEqual    = "less_than_or_equal"
+	CodeEmail              = "email"
+	CodeURL                = "url"
+	CodeOneOf              = "one_of"
+	CodeFuture             = "future"
+	CodeTaken              = "taken"   // unique values, like an email address, already in use
+	CodeUnknown            = "unknown" // a value outside a fixed set, the param is the value
+)
+
+// formats are the English messages for each code, with a verb for each parameter.
+// they're also the keys translations are looked up by
+var formats = map[string]string{
+	CodeRequired:           "must be provided",
+	CodeTooLong:            "must not be more than %d characters",
+	CodeTooShort:           "must be at least %d characters long",
+	CodeTooMany:            "must not contain more than %d items",
+	CodeTooFew:             "must contain at least %d items",
+	CodeGreaterThan:        "must be greater than %v",
+	CodeGreaterThanOrEqual: "must be greater than or equal to %v",
+	CodeLessThan:           "must be less than %v",
+	CodeLessThanOrEqual:    "must be less than or equal to %v",
+	CodeEmail:              "must be a valid email address",
+	CodeURL:                "must be an absolute http or https URL",
+	CodeOneOf:              "must be one of %s",
+	CodeFuture:             "must be in the future",
+	CodeTaken:              "is already in use",
+	CodeUnknown:            "contains an unknown value %q",
+}
+
+// Error is one validation failure: a stable code, the parameters that go with it
+// and the English message format, which translations are looked up by
+type Error struct {
+	Code   string
+	Params []interface{}
+	Format string
+}
+
+// Message returns the error in English
+func (e Error) Message() string {
+	return fmt.Sprintf(e.Format, e.Params...)
+}
+
+// newError returns the Error for one of the codes above
+func newError(code string, params ...interface{}) Error {
+	format, ok := formats[code]
+	if !ok {
+		panic("validator: unknown error code " + code)
+	}
+	return Error{Code: code, Params: params, Format: format}
+}
+
+// messageError wraps a plain English message, like the ones given to Check
+func messageError(code string, message string) Error {
+	return Error{Code: code, Format: strings.ReplaceAll(message, "%", "%%")}
+}
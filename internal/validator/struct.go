@@ -0,0 +1,350 @@
+package validator
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Rule reports whether a value passes a validate tag rule,
+// param is the text after "=" in the tag, e.g. "100" for max=100
+type Rule func(value reflect.Value, param string) bool
+
+type customRule struct {
+	rule    Rule
+	message string
+}
+
+var (
+	customRulesMu sync.RWMutex
+	customRules   = map[string]customRule{}
+)
+
+// RegisterRule makes a rule available to validate tags under name. When it fails
+// the error's code is the rule's name and message is its English message, which
+// can contain one verb for the tag's parameter, e.g. "must be a multiple of %s".
+// Built-in rules can't be replaced.
+func RegisterRule(name string, rule Rule, message string) {
+	if _, builtIn := builtInRules[name]; builtIn || name == "required" || name == "dive" || name == "omitempty" {
+		panic("validator: cannot replace built-in rule " + name)
+	}
+
+	customRulesMu.Lock()
+	defer customRulesMu.Unlock()
+
+	customRules[name] = customRule{rule: rule, message: message}
+}
+
+// builtInRules check a value and return an error, or nil when it passes.
+// required, omitempty and dive are handled by Struct itself
+var builtInRules = map[string]func(value reflect.Value, param string) *Error{
+	"max": func(value reflect.Value, param string) *Error {
+		size, unit := measure(value)
+		if size <= parseParam(param) {
+			return nil
+		}
+		switch unit {
+		case "characters":
+			return fail(CodeTooLong, paramInt(param))
+		case "items":
+			return fail(CodeTooMany, paramInt(param))
+		}
+		return fail(CodeLessThanOrEqual, paramNumber(param))
+	},
+	"min": func(value reflect.Value, param string) *Error {
+		size, unit := measure(value)
+		if size >= parseParam(param) {
+			return nil
+		}
+		switch unit {
+		case "characters":
+			return fail(CodeTooShort, paramInt(param))
+		case "items":
+			return fail(CodeTooFew, paramInt(param))
+		}
+		return fail(CodeGreaterThanOrEqual, paramNumber(param))
+	},
+	"gte": func(value reflect.Value, param string) *Error {
+		if number(value) < parseParam(param) {
+			return fail(CodeGreaterThanOrEqual, paramNumber(param))
+		}
+		return nil
+	},
+	"gt": func(value reflect.Value, param string) *Error {
+		if number(value) <= parseParam(param) {
+			return fail(CodeGreaterThan, paramNumber(param))
+		}
+		return nil
+	},
+	"lte": func(value reflect.Value, param string) *Error {
+		if number(value) > parseParam(param) {
+			return fail(CodeLessThanOrEqual, paramNumber(param))
+		}
+		return nil
+	},
+	"lt": func(value reflect.Value, param string) *Error {
+		if number(value) >= parseParam(param) {
+			return fail(CodeLessThan, paramNumber(param))
+		}
+		return nil
+	},
+	"email": func(value reflect.Value, param string) *Error {
+		if !Matches(value.String(), EmailRX) {
+			return fail(CodeEmail)
+		}
+		return nil
+	},
+	"url": func(value reflect.Value, param string) *Error {
+		u, err := url.Parse(value.String())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fail(CodeURL)
+		}
+		return nil
+	},
+	"oneof": func(value reflect.Value, param string) *Error {
+		options := strings.Fields(param)
+		if !PermittedValue(fmt.Sprint(value.Interface()), options...) {
+			return fail(CodeOneOf, strings.Join(options, ", "))
+		}
+		return nil
+	},
+}
+
+func fail(code string, params ...interface{}) *Error {
+	e := newError(code, params...)
+	return &e
+}
+
+// Struct validates a struct, or a pointer to one, against the validate tags on its fields:
+//
+//	Title string   `json:"title" validate:"required,max=100"`
+//	Tags  []string `json:"tags" validate:"max=10,dive,required,max=30"`
+//
+// Rules are separated by commas, rules after "dive" apply to each element of a slice,
+// and "omitempty" skips the rest of the rules when the value is empty. Errors are keyed
+// by the JSON path of the field, like "title", "address.city" or "tags[2]".
+// Nested structs, and structs in slices, are validated too.
+func (v *Validator) Struct(s interface{}) {
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		panic("validator: Struct called with a " + value.Kind().String())
+	}
+
+	v.validateStruct(value, "")
+}
+
+func (v *Validator) validateStruct(value reflect.Value, path string) {
+	t := value.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := jsonName(field)
+		tag := field.Tag.Get("validate")
+		if name == "-" || tag == "-" {
+			continue
+		}
+
+		// embedded structs without a JSON name are flattened into their parent, like encoding/json does
+		key := joinPath(path, name)
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			key = path
+		}
+
+		v.validateValue(value.Field(i), key, tag)
+	}
+}
+
+// validateValue applies tag's rules to value, then validates what's inside it
+func (v *Validator) validateValue(value reflect.Value, key string, tag string) {
+	var rules, elemRules []string
+	dive := false
+
+	if tag != "" {
+		rules = strings.Split(tag, ",")
+		if i := slices.Index(rules, "dive"); i >= 0 {
+			rules, elemRules, dive = rules[:i], rules[i+1:], true
+		}
+	}
+
+	if !v.applyRules(value, key, rules) {
+		return
+	}
+
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		v.validateStruct(value, key)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			elemKey := fmt.Sprintf("%s[%d]", key, i)
+			if dive {
+				v.validateValue(value.Index(i), elemKey, strings.Join(elemRules, ","))
+			} else {
+				v.validateValue(value.Index(i), elemKey, "")
+			}
+		}
+	}
+}
+
+// applyRules checks value against a list of rules, adding an error for every rule it fails.
+// It returns false when there is nothing more to validate because the value is missing
+func (v *Validator) applyRules(value reflect.Value, key string, rules []string) bool {
+	// required is the only rule a nil pointer can fail, the others need a value
+	deref := value
+	for deref.Kind() == reflect.Pointer || deref.Kind() == reflect.Interface {
+		if deref.IsNil() {
+			break
+		}
+		deref = deref.Elem()
+	}
+
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "omitempty":
+			if isEmpty(value) {
+				return false
+			}
+			continue
+
+		// a pointer only has to be set, so *bool can require true or false to be sent
+		case "required":
+			if isEmpty(value) || isEmpty(deref) && value.Kind() != reflect.Pointer {
+				v.AddErrorCode(key, CodeRequired)
+				return false
+			}
+			continue
+		}
+
+		if deref.Kind() == reflect.Pointer || deref.Kind() == reflect.Interface {
+			continue
+		}
+
+		if e := check(deref, name, param); e != nil {
+			v.add(key, *e)
+		}
+	}
+
+	return true
+}
+
+// check runs one rule, returning the error if it fails
+func check(value reflect.Value, name string, param string) *Error {
+	if builtIn, ok := builtInRules[name]; ok {
+		return builtIn(value, param)
+	}
+
+	customRulesMu.RLock()
+	custom, ok := customRules[name]
+	customRulesMu.RUnlock()
+
+	if !ok {
+		panic("validator: unknown rule " + name)
+	}
+
+	if custom.rule(value, param) {
+		return nil
+	}
+	if strings.Contains(custom.message, "%") {
+		return &Error{Code: name, Params: []interface{}{param}, Format: custom.message}
+	}
+	return &Error{Code: name, Format: custom.message}
+}
+
+// isEmpty reports whether value is missing, a nil pointer or a zero or empty value
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return value.IsNil()
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return value.Len() == 0
+	}
+	return !value.IsValid() || value.IsZero()
+}
+
+// measure returns what min and max compare: the length of strings in characters and the
+// number of items in slices and maps, with the unit for messages, or the value of a number
+func measure(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), "items"
+	}
+	return number(value), ""
+}
+
+// number returns the value of any numeric kind as a float64
+func number(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	panic("validator: rule needs a number, got a " + value.Kind().String())
+}
+
+// paramInt and paramNumber turn a rule's parameter into an error parameter,
+// so it is formatted as a number in every language
+func paramInt(param string) interface{} {
+	return int(parseParam(param))
+}
+
+func paramNumber(param string) interface{} {
+	n := parseParam(param)
+	if n == float64(int(n)) {
+		return int(n)
+	}
+	return n
+}
+
+func parseParam(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("validator: invalid rule parameter " + strconv.Quote(param))
+	}
+	return n
+}
+
+// jsonName returns the name encoding/json uses for a field
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
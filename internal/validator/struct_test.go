@@ -0,0 +1,268 @@
+package validator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testAddress struct {
+	Street string `json:"street" validate:"required"`
+	City   string `json:"city" validate:"required,max=20"`
+}
+
+type testLink struct {
+	URL string `json:"url" validate:"url"`
+}
+
+// Tracking is embedded in testProfile, Struct only looks into exported embedded types
+type Tracking struct {
+	Source string `json:"source" validate:"omitempty,max=3"`
+}
+
+type testProfile struct {
+	Tracking
+	Name     string       `json:"name" validate:"required,min=2,max=10"`
+	Contact  string       `json:"contact" validate:"min=6,email"`
+	Age      int          `json:"age" validate:"gte=18,lt=130"`
+	Role     string       `json:"role" validate:"oneof=candidate recruiter"`
+	Remote   *bool        `json:"remote" validate:"required"`
+	Tags     []string     `json:"tags" validate:"max=3,dive,required,max=5"`
+	Address  testAddress  `json:"address"`
+	Previous *testAddress `json:"previous_address"`
+	Links    []testLink   `json:"links"`
+	Skipped  string       `json:"-" validate:"required"`
+	NoTag    string       // no rules, and no JSON name
+	internal string       `validate:"required"`
+}
+
+func validProfile() testProfile {
+	remote := false
+	return testProfile{
+		Name:    "Zoë",
+		Contact: "zoe@example.com",
+		Age:     30,
+		Role:    "candidate",
+		Remote:  &remote,
+		Tags:    []string{"go", "sql"},
+		Address: testAddress{Street: "Main Street 1", City: "Berlin"},
+		Links:   []testLink{{URL: "https://example.com"}},
+	}
+}
+
+// fieldErrors lists each field's errors as "code: message", in the order they were found
+func fieldErrors(v *Validator) map[string][]string {
+	got := make(map[string][]string)
+	for key, errs := range v.FieldErrors {
+		for _, e := range errs {
+			got[key] = append(got[key], e.Code+": "+e.Message())
+		}
+	}
+	return got
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *testProfile)
+		want   map[string][]string
+	}{
+		{
+			name:   "valid",
+			modify: func(p *testProfile) {},
+			want:   map[string][]string{},
+		},
+		{
+			name:   "required and omitted",
+			modify: func(p *testProfile) { p.Name = ""; p.Remote = nil },
+			want: map[string][]string{
+				"name":   {"required: must be provided"},
+				"remote": {"required: must be provided"},
+			},
+		},
+		{
+			name: "a pointer only has to be set",
+			modify: func(p *testProfile) {
+				remote := false
+				p.Remote = &remote
+			},
+			want: map[string][]string{},
+		},
+		{
+			name:   "lengths count characters",
+			modify: func(p *testProfile) { p.Name = "Zoë Müller-Lüdenscheidt" },
+			want:   map[string][]string{"name": {"too_long: must not be more than 10 characters"}},
+		},
+		{
+			name:   "several errors for one field",
+			modify: func(p *testProfile) { p.Contact = "zoe@" },
+			want: map[string][]string{
+				"contact": {
+					"too_short: must be at least 6 characters long",
+					"email: must be a valid email address",
+				},
+			},
+		},
+		{
+			name:   "numbers",
+			modify: func(p *testProfile) { p.Age = 17 },
+			want:   map[string][]string{"age": {"greater_than_or_equal: must be greater than or equal to 18"}},
+		},
+		{
+			name:   "oneof",
+			modify: func(p *testProfile) { p.Role = "admin" },
+			want:   map[string][]string{"role": {"one_of: must be one of candidate, recruiter"}},
+		},
+		{
+			name:   "slice elements are keyed by index",
+			modify: func(p *testProfile) { p.Tags = []string{"go", "", "postgres"} },
+			want: map[string][]string{
+				"tags[1]": {"required: must be provided"},
+				"tags[2]": {"too_long: must not be more than 5 characters"},
+			},
+		},
+		{
+			name:   "rules before dive apply to the slice",
+			modify: func(p *testProfile) { p.Tags = []string{"a", "b", "c", "d"} },
+			want:   map[string][]string{"tags": {"too_many: must not contain more than 3 items"}},
+		},
+		{
+			name: "nested structs are keyed by their path",
+			modify: func(p *testProfile) {
+				p.Address = testAddress{City: "Llanfairpwllgwyngyllgogerychwyrndrobwllllantysiliogogogoch"}
+			},
+			want: map[string][]string{
+				"address.street": {"required: must be provided"},
+				"address.city":   {"too_long: must not be more than 20 characters"},
+			},
+		},
+		{
+			name:   "pointers to structs are validated when set",
+			modify: func(p *testProfile) { p.Previous = &testAddress{Street: "Old Street 2"} },
+			want:   map[string][]string{"previous_address.city": {"required: must be provided"}},
+		},
+		{
+			name:   "structs in slices",
+			modify: func(p *testProfile) { p.Links = append(p.Links, testLink{URL: "ftp://example.com"}) },
+			want:   map[string][]string{"links[1].url": {"url: must be an absolute http or https URL"}},
+		},
+		{
+			name:   "embedded structs are flattened",
+			modify: func(p *testProfile) { p.Source = "newsletter" },
+			want:   map[string][]string{"source": {"too_long: must not be more than 3 characters"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validProfile()
+			tt.modify(&p)
+
+			v := New()
+			v.Struct(&p)
+
+			got := fieldErrors(v)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+			if v.Valid() != (len(tt.want) == 0) {
+				t.Errorf("Valid() = %v", v.Valid())
+			}
+			for key, errs := range tt.want {
+				if want := strings.SplitN(errs[0], ": ", 2)[1]; v.Errors[key] != want {
+					t.Errorf("Errors[%q] = %q, want the first message %q", key, v.Errors[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestStructNilPointer(t *testing.T) {
+	v := New()
+	v.Struct((*testProfile)(nil))
+	if !v.Valid() {
+		t.Errorf("errors = %q", v.Errors)
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	RegisterRule("test_even", func(value reflect.Value, param string) bool {
+		return value.Int()%2 == 0
+	}, "must be even")
+	RegisterRule("test_prefix", func(value reflect.Value, param string) bool {
+		return strings.HasPrefix(value.String(), param)
+	}, "must start with %s")
+
+	type form struct {
+		Count int    `json:"count" validate:"test_even,gt=0"`
+		Code  string `json:"code" validate:"required,test_prefix=GJ-"`
+	}
+
+	tests := []struct {
+		name string
+		form form
+		want map[string][]string
+	}{
+		{"valid", form{Count: 4, Code: "GJ-7"}, map[string][]string{}},
+		{"message without a parameter", form{Count: 3, Code: "GJ-7"}, map[string][]string{
+			"count": {"test_even: must be even"},
+		}},
+		{"message with the parameter", form{Count: 2, Code: "XX-7"}, map[string][]string{
+			"code": {"test_prefix: must start with GJ-"},
+		}},
+		{"with built-in rules", form{Count: -1, Code: ""}, map[string][]string{
+			"count": {"test_even: must be even", "greater_than: must be greater than 0"},
+			"code":  {"required: must be provided"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.Struct(tt.form)
+
+			got := fieldErrors(v)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructPanics(t *testing.T) {
+	type unknownRule struct {
+		Name string `json:"name" validate:"required,shiny"`
+	}
+	type badParam struct {
+		Name string `json:"name" validate:"max=ten"`
+	}
+	type notANumber struct {
+		Name string `json:"name" validate:"gt=3"`
+	}
+
+	tests := []struct {
+		name string
+		call func()
+		want string
+	}{
+		{"unknown rule", func() { New().Struct(unknownRule{Name: "Zoë"}) }, "validator: unknown rule shiny"},
+		{"invalid parameter", func() { New().Struct(badParam{Name: "Zoë"}) }, `validator: invalid rule parameter "ten"`},
+		{"number rule on a string", func() { New().Struct(notANumber{Name: "Zoë"}) }, "validator: rule needs a number, got a string"},
+		{"not a struct", func() { New().Struct("Zoë") }, "validator: Struct called with a string"},
+		{"replacing a built-in rule", func() { RegisterRule("max", nil, "") }, "validator: cannot replace built-in rule max"},
+		{"replacing required", func() { RegisterRule("required", nil, "") }, "validator: cannot replace built-in rule required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				got := fmt.Sprint(recover())
+				if got != tt.want {
+					t.Errorf("panic = %q, want %q", got, tt.want)
+				}
+			}()
+			tt.call()
+		})
+	}
+}
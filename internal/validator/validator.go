@@ -11,11 +11,15 @@ var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9
 // the key is the field name, and the value is the error message
 type Validator struct {
 	Errors map[string]string
+	// FieldErrors has every error for each field in the order they were found,
+	// with their codes. Errors only keeps the first message, in English
+	FieldErrors map[string][]Error
 }
 
 func New() *Validator {
 	return &Validator{
-		Errors: make(map[string]string),
+		Errors:      make(map[string]string),
+		FieldErrors: make(map[string][]Error),
 	}
 }
 
@@ -24,11 +28,30 @@ func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
 
-// AddError adds an error message to the map if it doesnt exist
+// AddError adds an error message for a field with the generic "invalid" code,
+// the same message is only added once
 func (v *Validator) AddError(key, message string) {
+	v.add(key, messageError(CodeInvalid, message))
+}
+
+// AddErrorCode adds an error for a field by its code, params fill in the code's message
+func (v *Validator) AddErrorCode(key, code string, params ...interface{}) {
+	v.add(key, newError(code, params...))
+}
+
+func (v *Validator) add(key string, e Error) {
+	message := e.Message()
+
 	if _, exists := v.Errors[key]; !exists {
 		v.Errors[key] = message
 	}
+
+	for _, existing := range v.FieldErrors[key] {
+		if existing.Message() == message {
+			return
+		}
+	}
+	v.FieldErrors[key] = append(v.FieldErrors[key], e)
 }
 
 // Check is a helper
@@ -40,7 +63,24 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// CheckCode is Check for errors with a code
+func (v *Validator) CheckCode(ok bool, key, code string, params ...interface{}) {
+	if !ok {
+		v.AddErrorCode(key, code, params...)
+	}
+}
+
 // returns true if a string value matches a specific regex pattern
 func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
+
+// PermittedValue returns true if value is one of the permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for _, permitted := range permittedValues {
+		if value == permitted {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// task statuses
+// tasks that succeed are deleted, so there is no status for them
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDead    = "dead" // ran out of attempts, kept for inspection
+)
+
+// Task is a unit of background work stored in the tasks table
+type Task struct {
+	Id          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int // including the current one
+	MaxAttempts int
+}
+
+// Decode unmarshals the task payload into dst
+func (t *Task) Decode(dst interface{}) error {
+	return json.Unmarshal(t.Payload, dst)
+}
+
+// Handler processes a task, returning an error schedules a retry
+type Handler func(ctx context.Context, task *Task) error
+
+// Execer is implemented by both *sql.DB and *sql.Tx.
+// passing a transaction to Enqueue is what makes the tasks table an outbox:
+// the task only exists if the write it belongs to commits.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue stores a task to be run as soon as a worker picks it up
+func Enqueue(ctx context.Context, db Execer, kind string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO tasks (kind, payload) VALUES ($1, $2)`
+
+	_, err = db.ExecContext(ctx, query, kind, string(body))
+	return err
+}
+
+// periodic is a function the worker runs on an interval
+type periodic struct {
+	name     string
+	interval time.Duration
+	fn       func(ctx context.Context) error
+}
+
+// Worker claims tasks from the tasks table and runs the matching handler
+type Worker struct {
+	DB     *sql.DB
+	Logger *slog.Logger
+
+	Concurrency     int           // tasks run at the same time
+	PollInterval    time.Duration // wait between claims when the queue is empty
+	Lease           time.Duration // how long a claimed task is hidden from other workers
+	Timeout         time.Duration // how long a handler may run
+	PeriodicTimeout time.Duration // how long a periodic function may run, also during shutdown
+	BaseDelay       time.Duration // first retry delay, doubled on each attempt
+	MaxDelay        time.Duration
+
+	handlers  map[string]Handler
+	periodic  []periodic
+	heartbeat atomic.Int64 // unix nanoseconds, see LastHeartbeat
+}
+
+// New returns a worker with sensible defaults
+func New(db *sql.DB, logger *slog.Logger) *Worker {
+	return &Worker{
+		DB:              db,
+		Logger:          logger,
+		Concurrency:     4,
+		PollInterval:    time.Second,
+		Lease:           5 * time.Minute,
+		Timeout:         time.Minute,
+		PeriodicTimeout: 5 * time.Minute,
+		BaseDelay:       10 * time.Second,
+		MaxDelay:        time.Hour,
+		handlers:        make(map[string]Handler),
+	}
+}
+
+// Handle registers the handler for a kind of task
+func (w *Worker) Handle(kind string, handler Handler) {
+	w.handlers[kind] = handler
+}
+
+// Every registers fn to run on an interval.
+// a Postgres advisory lock keyed by name makes sure only one instance runs it at a time,
+// its context has a deadline of PeriodicTimeout
+func (w *Worker) Every(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	w.periodic = append(w.periodic, periodic{name: name, interval: interval, fn: fn})
+}
+
+// Run processes tasks and periodic functions until ctx is cancelled.
+// It then stops claiming new work and returns once everything in flight has finished.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Go(func() {
+			w.loop(ctx)
+		})
+	}
+
+	for _, p := range w.periodic {
+		wg.Go(func() {
+			w.runPeriodic(ctx, p)
+		})
+	}
+
+	wg.Wait()
+	w.Logger.Info("Worker stopped")
+}
+
+// LastHeartbeat returns when a worker loop last went round, the zero time before Run.
+// Loops beat before every claim, so a stale heartbeat means every loop is stuck
+func (w *Worker) LastHeartbeat() time.Time {
+	n := w.heartbeat.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// loop claims and runs one task at a time until ctx is cancelled
+func (w *Worker) loop(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		w.heartbeat.Store(time.Now().UnixNano())
+
+		task, err := w.claim(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			w.Logger.Error("Task claim failed", "error", err)
+		}
+
+		// nothing to do, wait before polling again
+		if task == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+
+		w.process(ctx, task)
+	}
+}
+
+// claim leases the next due task, or returns nil if there is none.
+// SKIP LOCKED lets several workers claim concurrently without waiting on each other,
+// and running tasks whose lease expired (the worker died) are picked up again.
+func (w *Worker) claim(ctx context.Context) (*Task, error) {
+	query := `
+		UPDATE tasks
+		SET status = 'running', attempts = attempts + 1, locked_until = NOW() + make_interval(secs => $1::float8)
+		WHERE id = (
+			SELECT id FROM tasks
+			WHERE (status = 'pending' AND run_at <= NOW())
+			OR (status = 'running' AND locked_until < NOW())
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, payload, attempts, max_attempts`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var task Task
+	err := w.DB.QueryRowContext(ctx, query, w.Lease.Seconds()).Scan(
+		&task.Id,
+		&task.Kind,
+		&task.Payload,
+		&task.Attempts,
+		&task.MaxAttempts,
+	)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+// process runs the handler for a claimed task and records the outcome.
+// The outcome is written with a context of its own, a handler that used up its
+// timeout must still get its retry or dead letter recorded
+func (w *Worker) process(ctx context.Context, task *Task) {
+	// a task that has started is allowed to finish during shutdown
+	ctx = context.WithoutCancel(ctx)
+
+	start := time.Now()
+	err := w.run(ctx, task)
+
+	if err == nil {
+		w.Logger.Debug("Task succeeded", "task_id", task.Id, "kind", task.Kind, "duration", time.Since(start).String())
+
+		err = w.record(ctx, `DELETE FROM tasks WHERE id = $1`, task.Id)
+		if err != nil {
+			w.Logger.Error("Task completion failed", "task_id", task.Id, "error", err)
+		}
+		return
+	}
+
+	// dead letter once the attempts run out
+	if task.Attempts >= task.MaxAttempts {
+		w.Logger.Error("Task failed permanently", "task_id", task.Id, "kind", task.Kind, "attempts", task.Attempts, "error", err.Error())
+
+		err = w.record(ctx, `UPDATE tasks SET status = 'dead', locked_until = NULL, last_error = $2 WHERE id = $1`, task.Id, err.Error())
+		if err != nil {
+			w.Logger.Error("Task dead lettering failed", "task_id", task.Id, "error", err)
+		}
+		return
+	}
+
+	delay := w.backoff(task.Attempts)
+	w.Logger.Warn("Task failed", "task_id", task.Id, "kind", task.Kind, "attempt", task.Attempts, "retry_in", delay.String(), "error", err.Error())
+
+	query := `
+		UPDATE tasks
+		SET status = 'pending', locked_until = NULL, last_error = $2, run_at = NOW() + make_interval(secs => $3::float8)
+		WHERE id = $1`
+
+	err = w.record(ctx, query, task.Id, err.Error(), delay.Seconds())
+	if err != nil {
+		w.Logger.Error("Task retry scheduling failed", "task_id", task.Id, "error", err)
+	}
+}
+
+// record writes a task's outcome on a fresh context, whatever happened to the handler's
+func (w *Worker) record(ctx context.Context, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+	defer cancel()
+
+	_, err := w.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// run calls the handler with a deadline of Timeout, turning a panic or an unknown
+// kind into an error
+func (w *Worker) run(ctx context.Context, task *Task) (err error) {
+	handler, ok := w.handlers[task.Kind]
+	if !ok {
+		// no point retrying, a deploy that knows the kind can requeue dead tasks
+		task.Attempts = task.MaxAttempts
+		return fmt.Errorf("no handler for task kind %q", task.Kind)
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("task panicked: %v", rec)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	return handler(ctx, task)
+}
+
+// backoff is the delay before the next attempt: exponential with up to 20% jitter
+// so tasks that failed together don't all retry together
+func (w *Worker) backoff(attempt int) time.Duration {
+	delay := w.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > w.MaxDelay {
+		delay = w.MaxDelay
+	}
+	return delay + rand.N(delay/5+1)
+}
+
+// runPeriodic calls p.fn every p.interval until ctx is cancelled
+func (w *Worker) runPeriodic(ctx context.Context, p periodic) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.runLocked(context.WithoutCancel(ctx), p)
+			if err != nil {
+				w.Logger.Error("Periodic task failed", "name", p.name, "error", err)
+			}
+		}
+	}
+}
+
+// runLocked runs p.fn while holding a session-level advisory lock on a connection of
+// its own, other instances fail to take the lock and skip this round. No transaction
+// stays open while p.fn runs, and p.fn gets PeriodicTimeout to finish
+func (w *Worker) runLocked(ctx context.Context, p periodic) error {
+	conn, err := w.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := "worker:" + p.name
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, key).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer w.unlock(ctx, conn, key)
+
+	ctx, cancel := context.WithTimeout(ctx, w.PeriodicTimeout)
+	defer cancel()
+
+	return p.fn(ctx)
+}
+
+// unlock releases the advisory lock before conn goes back to the pool. If that fails
+// the connection is thrown away instead, ending the session releases the lock too
+func (w *Worker) unlock(ctx context.Context, conn *sql.Conn, key string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+	defer cancel()
+
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtext($1))`, key)
+	if err != nil {
+		w.Logger.Error("Periodic task unlock failed", "key", key, "error", err)
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// execLog is a database/sql driver that records statements instead of running them.
+// Like a real driver it refuses to run a statement once its context is done
+type execLog struct {
+	mu    sync.Mutex
+	execs []execRecord
+}
+
+type execRecord struct {
+	query string
+	err   error
+}
+
+func (l *execLog) Connect(context.Context) (driver.Conn, error) { return execConn{l}, nil }
+func (l *execLog) Driver() driver.Driver                        { return nil }
+
+func (l *execLog) records() []execRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]execRecord(nil), l.execs...)
+}
+
+type execConn struct{ log *execLog }
+
+func (c execConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c execConn) Close() error                        { return nil }
+func (c execConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c execConn) ExecContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	err := ctx.Err()
+
+	c.log.mu.Lock()
+	c.log.execs = append(c.log.execs, execRecord{query: strings.Join(strings.Fields(query), " "), err: err})
+	c.log.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func newTestWorker(t *testing.T) (*Worker, *execLog) {
+	t.Helper()
+
+	log := &execLog{}
+	db := sql.OpenDB(log)
+	t.Cleanup(func() { db.Close() })
+
+	w := New(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	w.Timeout = 50 * time.Millisecond
+	return w, log
+}
+
+func TestProcessHandlerOverrunsTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		handler  Handler
+		want     string // start of the statement recording the outcome
+	}{
+		{
+			name:     "gives up when the context ends, retried",
+			attempts: 1,
+			handler: func(ctx context.Context, task *Task) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			want: "UPDATE tasks SET status = 'pending'",
+		},
+		{
+			name:     "gives up when the context ends, out of attempts",
+			attempts: 3,
+			handler: func(ctx context.Context, task *Task) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			want: "UPDATE tasks SET status = 'dead'",
+		},
+		{
+			name:     "ignores the context and succeeds late",
+			attempts: 1,
+			handler: func(ctx context.Context, task *Task) error {
+				time.Sleep(100 * time.Millisecond)
+				return nil
+			},
+			want: "DELETE FROM tasks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, log := newTestWorker(t)
+			w.Handle("slow", tt.handler)
+
+			w.process(context.Background(), &Task{Id: 7, Kind: "slow", Attempts: tt.attempts, MaxAttempts: 3})
+
+			execs := log.records()
+			if len(execs) != 1 {
+				t.Fatalf("statements = %+v, want one recording the outcome", execs)
+			}
+			if !strings.HasPrefix(execs[0].query, tt.want) {
+				t.Errorf("statement = %q, want %q", execs[0].query, tt.want)
+			}
+			if execs[0].err != nil {
+				t.Errorf("statement ran on a finished context: %v", execs[0].err)
+			}
+		})
+	}
+}
+
+func TestProcessHandlerDeadline(t *testing.T) {
+	w, _ := newTestWorker(t)
+
+	var deadline time.Time
+	w.Handle("check", func(ctx context.Context, task *Task) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+
+	// shutting down doesn't cancel a task that has started
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	w.process(ctx, &Task{Id: 1, Kind: "check", Attempts: 1, MaxAttempts: 3})
+
+	if deadline.IsZero() || deadline.Sub(start) > w.Timeout+time.Second {
+		t.Errorf("handler deadline = %v, want about Timeout from the start", deadline)
+	}
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS offers (
+    id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    salary INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    start_date DATE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    terms TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'draft', -- 'draft', 'sent', 'accepted', 'declined', 'expired'
+    sent_at TIMESTAMPTZ,
+    responded_at TIMESTAMPTZ,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- only one open (draft or sent) offer per application
+CREATE UNIQUE INDEX IF NOT EXISTS idx_offers_open_application
+    ON offers(application_id) WHERE status IN ('draft', 'sent');
+
+-- used by the expiry sweep
+CREATE INDEX IF NOT EXISTS idx_offers_sent_expires_at
+    ON offers(expires_at) WHERE status = 'sent';
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL REFERENCES applications(id) ON DELETE CASCADE,
+    sender_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    read_at TIMESTAMPTZ, -- set when the other participant reads the message
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_application_id ON messages(application_id, id);
+
+-- unread counts only ever look at unread rows
+CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(application_id) WHERE read_at IS NULL;
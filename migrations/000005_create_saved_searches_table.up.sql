@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL, -- url encoded GET /jobs parameters, e.g. title=go&sort=-salary
+    frequency TEXT NOT NULL DEFAULT 'daily', -- 'instant', 'daily', 'none'
+    last_job_id INT NOT NULL DEFAULT 0, -- highest job id already considered for alerts
+    last_run_at TIMESTAMPTZ,
+    unsubscribe_token TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_saved_searches_user_id ON saved_searches(user_id);
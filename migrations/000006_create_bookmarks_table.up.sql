@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS bookmarks (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    job_id INT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (user_id, job_id)
+);
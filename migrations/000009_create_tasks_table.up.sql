@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS tasks (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending', -- 'pending', 'running', 'dead'
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 8,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ, -- lease held by the worker running the task
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- workers claim pending tasks that are due, and running tasks whose lease ran out
+CREATE INDEX IF NOT EXISTS idx_tasks_pending_run_at ON tasks(run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_tasks_running_locked_until ON tasks(locked_until) WHERE status = 'running';
@@ -0,0 +1,8 @@
+-- users without a row get every notification
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    application_received BOOLEAN NOT NULL DEFAULT TRUE,
+    application_status BOOLEAN NOT NULL DEFAULT TRUE,
+    new_applicant BOOLEAN NOT NULL DEFAULT TRUE,
+    new_message BOOLEAN NOT NULL DEFAULT TRUE
+);
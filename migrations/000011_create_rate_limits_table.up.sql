@@ -0,0 +1,11 @@
+-- token buckets for the rate limiter when RATE_LIMIT_STORE=postgres
+-- UNLOGGED skips the WAL, losing the buckets in a crash only resets the limits
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL, -- whether the last request was let through
+    updated_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL -- the bucket is full again by then
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limits_expires_at ON rate_limits(expires_at);
@@ -0,0 +1,23 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret TEXT, -- set on enrolment, only used once mfa_enabled
+    ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS totp_last_step BIGINT; -- last accepted time step, codes can't be replayed
+
+-- single-use codes for when the authenticator is lost, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+-- companies whose recruiters must use two-factor authentication
+-- a recruiter belongs to the companies they have posted jobs for
+CREATE TABLE IF NOT EXISTS company_mfa_policies (
+    company TEXT PRIMARY KEY,
+    require_mfa BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
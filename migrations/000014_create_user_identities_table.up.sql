@@ -0,0 +1,11 @@
+-- accounts at OpenID Connect providers linked to our users
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL, -- the provider's stable id for the account, the sub claim
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL, -- email the provider verified when the identity was linked
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
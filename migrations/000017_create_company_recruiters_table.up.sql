@@ -0,0 +1,11 @@
+-- recruiters an admin has confirmed work for a company, company MFA policies apply to them.
+-- jobs.company is free text anyone can fill in, so it can't say who belongs to a company
+CREATE TABLE IF NOT EXISTS company_recruiters (
+    company TEXT NOT NULL,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    added_by INT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (company, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_recruiters_user_id ON company_recruiters(user_id);